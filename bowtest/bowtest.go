@@ -0,0 +1,66 @@
+// Package bowtest provides helpers to test handlers of applications built with bow.
+// It is a separate package, so that testing dependencies are not pulled into production builds.
+package bowtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobre/bow"
+)
+
+// NewTestCore creates a core from in-memory files, given as a map of paths to contents
+// such as "views/index.html". Options are applied as with bow.NewCore.
+// The test fails immediately if the core cannot be created.
+func NewTestCore(t testing.TB, files map[string]string, options ...bow.Option) *bow.Core {
+	t.Helper()
+
+	fsys := make(fstest.MapFS, len(files))
+	for path, content := range files {
+		fsys[path] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	core, err := bow.NewCore(fsys, options...)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	return core
+}
+
+// Serve executes the request against the handler and records the response.
+func Serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+// AssertStatus checks that the recorded response has the expected status code.
+func AssertStatus(t testing.TB, rr *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rr.Code != want {
+		t.Errorf("want status %d, got %d", want, rr.Code)
+	}
+}
+
+// AssertBodyContains checks that the body of the recorded response contains the given string.
+func AssertBodyContains(t testing.TB, rr *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	if body := rr.Body.String(); !strings.Contains(body, want) {
+		t.Errorf("want body to contain %q, got %q", want, body)
+	}
+}
+
+// AssertHeader checks that the recorded response has a header with the expected value.
+func AssertHeader(t testing.TB, rr *httptest.ResponseRecorder, key, want string) {
+	t.Helper()
+
+	if got := rr.Header().Get(key); got != want {
+		t.Errorf("want header %s to be %q, got %q", key, want, got)
+	}
+}
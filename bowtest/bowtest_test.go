@@ -0,0 +1,24 @@
+package bowtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	core := NewTestCore(t, map[string]string{
+		"views/layouts/base.html": `{{ template "main" . }}`,
+		"views/index.html":        `{{ define "main" }}hello, {{ . }}{{ end }}`,
+	})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.Views.Render(w, r, http.StatusOK, "index", "world")
+	})
+
+	rr := Serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	AssertStatus(t, rr, http.StatusOK)
+	AssertBodyContains(t, rr, "hello, world")
+	AssertHeader(t, rr, "Content-Type", "text/html")
+}
@@ -0,0 +1,108 @@
+package bow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries is the maximum number of rendered views kept in memory.
+const maxCacheEntries = 256
+
+// cacheEntry is a rendered output along with its expiration time.
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// renderCache is a bounded in-memory cache of rendered views
+// that is safe for concurrent use.
+type renderCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]cacheEntry
+}
+
+// newRenderCache creates a cache holding at most max entries.
+func newRenderCache(max int) *renderCache {
+	return &renderCache{
+		max:     max,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get returns the cached output for the given key if it has not expired.
+func (c *renderCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.body, true
+}
+
+// put stores an output for the given key until ttl expires.
+// When the cache is full, expired entries are removed first,
+// then the entry that expires the soonest.
+func (c *renderCache) put(key string, body []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.max {
+		c.evict()
+	}
+
+	c.entries[key] = cacheEntry{
+		body:    body,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// evict makes room for a new entry. It should be called with the lock held.
+func (c *renderCache) evict() {
+	now := time.Now()
+
+	var oldest string
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+			continue
+		}
+
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+
+	if len(c.entries) >= c.max {
+		delete(c.entries, oldest)
+	}
+}
+
+// cacheKey computes a cache key from a view name, the template executed for it,
+// which depends on the layout of the request, and its data.
+func cacheKey(name, entry string, data interface{}) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(entry))
+	h.Write([]byte{0})
+	h.Write(b)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
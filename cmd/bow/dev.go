@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type devConfig struct {
+	Port    int
+	AppPort int
+	Delay   time.Duration
+	Args    []string
+}
+
+// watchedDirs are the folders of the project that trigger a reload when changed.
+var watchedDirs = []string{"views", "assets", "translations"}
+
+// reloadPath is the path of the event stream notifying browsers to reload,
+// and reloadScriptPath the one of the script listening to it.
+const (
+	reloadPath       = "/_bow/reload"
+	reloadScriptPath = "/_bow/reload.js"
+)
+
+// reloadScript reloads the page when the development server asks to.
+// It is served as a file, so that it is allowed by the default content security policy.
+const reloadScript = `new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };`
+
+// dev builds and runs the project behind a proxy that injects a reload script into html pages.
+// Views, assets and translations are embedded into the binary, so when they change,
+// the project is rebuilt and restarted to parse them again, and then browsers are reloaded.
+// This is meant for development only.
+func dev(conf devConfig) error {
+	tmp, err := os.MkdirTemp("", "bow-dev")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range watchedDirs {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := watchDir(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	app := devApp{
+		bin:  filepath.Join(tmp, "app"),
+		addr: fmt.Sprintf("localhost:%d", conf.AppPort),
+		args: append([]string{"-port", strconv.Itoa(conf.AppPort), "-debug"}, conf.Args...),
+	}
+
+	if err := app.restart(); err != nil {
+		return err
+	}
+	defer app.stop()
+
+	var rl reloader
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: app.addr})
+	proxy.ModifyResponse = injectReloadScript
+
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, &rl)
+	mux.HandleFunc(reloadScriptPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript")
+		io.WriteString(w, reloadScript)
+	})
+	mux.Handle("/", proxy)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", conf.Port),
+		Handler: mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	fmt.Printf("development server listening on http://localhost:%d\n", conf.Port)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// reload is only set once changes have settled, to debounce rapid successive writes
+	var reload <-chan time.Time
+
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Op == fsnotify.Chmod || ignoredFile(event.Name) {
+				continue
+			}
+
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchDir(watcher, event.Name); err != nil {
+						fmt.Fprintf(os.Stderr, "cannot watch %s: %s\n", event.Name, err)
+					}
+				}
+			}
+
+			reload = time.After(conf.Delay)
+
+		case <-reload:
+			reload = nil
+
+			fmt.Println("changes detected, reloading")
+
+			if err := app.restart(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+
+			rl.notify()
+
+		case err := <-watcher.Errors:
+			fmt.Fprintf(os.Stderr, "watcher: %s\n", err)
+
+		case err := <-errs:
+			return err
+
+		case <-stop:
+			fmt.Println("stopping development server")
+			return srv.Close()
+		}
+	}
+}
+
+// watchDir adds dir and all its subfolders to the watcher.
+func watchDir(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+// ignoredFile returns true for hidden and backup files, such as the ones created by editors.
+func ignoredFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, ".") || strings.HasSuffix(base, "~")
+}
+
+// devApp is the project being developed, running in a child process.
+type devApp struct {
+	bin  string
+	addr string
+	args []string
+	cmd  *exec.Cmd
+}
+
+// restart builds the project and replaces the running process with the new binary.
+// If the build fails, the running process is kept.
+func (app *devApp) restart() error {
+	build := exec.Command("go", "build", "-o", app.bin+".new", ".")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("cannot build: %w", err)
+	}
+
+	app.stop()
+
+	if err := os.Rename(app.bin+".new", app.bin); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(app.bin, app.args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start: %w", err)
+	}
+
+	app.cmd = cmd
+
+	return waitListening(app.addr, 10*time.Second)
+}
+
+// stop gracefully stops the running process, and kills it if it takes too long.
+func (app *devApp) stop() {
+	if app.cmd == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		app.cmd.Wait()
+		close(done)
+	}()
+
+	// interrupts are not supported on all platforms
+	if err := app.cmd.Process.Signal(os.Interrupt); err != nil {
+		app.cmd.Process.Kill()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		app.cmd.Process.Kill()
+		<-done
+	}
+
+	app.cmd = nil
+}
+
+// waitListening waits until addr accepts connections.
+func waitListening(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			return conn.Close()
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("application is not listening on %s", addr)
+}
+
+// injectReloadScript adds the reload script to proxied html pages. It is added to the head
+// if possible, so that it is not executed again when the body is replaced, such as with Turbo.
+func injectReloadScript(resp *http.Response) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	tag := []byte(`<script src="` + reloadScriptPath + `"></script>`)
+
+	i := bytes.Index(body, []byte("</head>"))
+	if i < 0 {
+		i = bytes.LastIndex(body, []byte("</body>"))
+	}
+	if i < 0 {
+		i = len(body)
+	}
+
+	body = append(body[:i:i], append(tag, body[i:]...)...)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return nil
+}
+
+// reloader is an event stream notifying connected browsers to reload.
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan struct{}, 1)
+
+	rl.mu.Lock()
+	if rl.clients == nil {
+		rl.clients = make(map[chan struct{}]bool)
+	}
+	rl.clients[ch] = true
+	rl.mu.Unlock()
+
+	defer func() {
+		rl.mu.Lock()
+		delete(rl.clients, ch)
+		rl.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	select {
+	case <-ch:
+		io.WriteString(w, "data: reload\n\n")
+		flusher.Flush()
+	case <-r.Context().Done():
+	}
+}
+
+// notify asks all connected browsers to reload.
+func (rl *reloader) notify() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for ch := range rl.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//go:embed gen
+var gen embed.FS
+
+// validName matches names that can be used both as go identifiers and in urls.
+var validName = regexp.MustCompile("^[a-z][a-z0-9]*$")
+
+type genConfig struct {
+	Name  string // singular lowercase name (e.g. post)
+	Names string // plural lowercase name (e.g. posts)
+	Type  string // go type name (e.g. Post)
+	Types string // plural go type name (e.g. Posts)
+
+	WithDB bool
+}
+
+// newGenConfig creates the config of a scaffold from the singular name of the resource.
+// If names is empty, the plural name is derived from the singular one.
+func newGenConfig(name, names string) (genConfig, error) {
+	if !validName.MatchString(name) {
+		return genConfig{}, fmt.Errorf("name %s is not valid, it should be a lowercase singular word", name)
+	}
+
+	if names == "" {
+		names = plural(name)
+	}
+
+	if !validName.MatchString(names) || names == name {
+		return genConfig{}, fmt.Errorf("plural %s is not valid, it should be a lowercase plural word", names)
+	}
+
+	return genConfig{
+		Name:  name,
+		Names: names,
+		Type:  strings.ToUpper(name[:1]) + name[1:],
+		Types: strings.ToUpper(names[:1]) + names[1:],
+	}, nil
+}
+
+// plural returns the plural of an english word using the regular rules.
+// Irregular plurals such as people have to be given explicitly.
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "z"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	default:
+		return name + "s"
+	}
+}
+
+// generate generates the files of the given kind of scaffold.
+// Only handlers are supported for now.
+func generate(kind string, conf genConfig) error {
+	if kind != "handler" {
+		return fmt.Errorf("cannot generate %s, only handler is supported", kind)
+	}
+
+	if _, err := os.Stat("views"); errors.Is(err, os.ErrNotExist) {
+		return errors.New("please init a bow project with 'bow init' first")
+	}
+
+	root := filepath.Join("gen", kind)
+
+	err := fs.WalkDir(gen, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		// compute local path without gen/<kind>/ and with the name
+		localPath := strings.TrimPrefix(path, root+"/")
+		localPath = strings.ReplaceAll(localPath, "NAME", conf.Name)
+		localPath = strings.TrimSuffix(localPath, ".tmpl")
+		localPath = filepath.FromSlash(localPath)
+
+		// skip repository if no db
+		if !conf.WithDB && strings.HasPrefix(filepath.Base(localPath), "repo_") {
+			return nil
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(localPath, os.ModeDir|0755)
+		}
+
+		return createFile(gen, path, localPath, conf)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nregister the routes in routes.go:\n\n")
+	fmt.Printf("\tapp.%sRoutes(router, dynamic)\n", conf.Name)
+
+	if conf.WithDB {
+		fmt.Printf("\nadd the repository to the application in main.go:\n\n")
+		fmt.Printf("\t%sRepo *%sRepo\n", conf.Name, conf.Type)
+		fmt.Printf("\tapp.%sRepo = &%sRepo{db: app.DB}\n", conf.Name, conf.Type)
+		fmt.Printf("\nand contribute a migration for the %s table\n", conf.Names)
+	}
+
+	return nil
+}
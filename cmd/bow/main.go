@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"golang.org/x/mod/modfile"
 )
@@ -42,6 +43,40 @@ func run(args []string, stdout io.Writer) error {
 	initCmd.BoolVar(&initConf.WithSession, "with-session", false, "with session")
 	initCmd.BoolVar(&initConf.WithTranslator, "with-translator", false, "with translator")
 
+	var validateConf validateConfig
+	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	validateCmd.StringVar(&validateConf.Dir, "views-dir", "views", "views folder")
+	validateCmd.StringVar(&validateConf.Extensions, "extensions", "", "comma-separated extensions of html views")
+	validateCmd.StringVar(&validateConf.LeftDelim, "left-delim", "", "left template delimiter")
+	validateCmd.StringVar(&validateConf.RightDelim, "right-delim", "", "right template delimiter")
+
+	var migrateConf migrateConfig
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	migrateCmd.StringVar(&migrateConf.DSN, "dsn", "", "database data source name")
+	migrateCmd.StringVar(&migrateConf.Migrations, "migrations", "migrations", "migrations folder")
+	migrateCmd.BoolVar(&migrateConf.Status, "status", false, "list applied and pending migrations")
+	migrateCmd.BoolVar(&migrateConf.Force, "force", false, "accept applied migrations that have been modified")
+
+	var devConf devConfig
+	devCmd := flag.NewFlagSet("dev", flag.ExitOnError)
+	devCmd.IntVar(&devConf.Port, "port", 8080, "development server port")
+	devCmd.IntVar(&devConf.AppPort, "app-port", 8081, "port given to the application")
+	devCmd.DurationVar(&devConf.Delay, "delay", 200*time.Millisecond, "delay to wait for changes to settle before reloading")
+	devCmd.Usage = func() {
+		fmt.Fprintf(devCmd.Output(), "Usage: %s dev [flags] [-- APP FLAGS]\n", filepath.Base(args[0]))
+		devCmd.PrintDefaults()
+	}
+
+	var genWithDB bool
+	var genPlural string
+	genCmd := flag.NewFlagSet("gen", flag.ExitOnError)
+	genCmd.BoolVar(&genWithDB, "with-db", false, "with database repository")
+	genCmd.StringVar(&genPlural, "plural", "", "plural name, if it is not regular")
+	genCmd.Usage = func() {
+		fmt.Fprintf(genCmd.Output(), "Usage: %s gen handler [flags] NAME\n", filepath.Base(args[0]))
+		genCmd.PrintDefaults()
+	}
+
 	prg := filepath.Base(args[0])
 
 	if len(args) < 2 {
@@ -53,6 +88,36 @@ func run(args []string, stdout io.Writer) error {
 	case "init":
 		initCmd.Parse(args[2:])
 		return initialize(initConf)
+	case "gen":
+		if len(args) < 3 {
+			genCmd.Usage()
+			return errors.New("missing kind of scaffold")
+		}
+		genCmd.Parse(args[3:])
+		if genCmd.NArg() == 0 {
+			genCmd.Usage()
+			return errors.New("missing name of scaffold")
+		}
+		if genCmd.NArg() > 1 {
+			genCmd.Usage()
+			return fmt.Errorf("unexpected arguments after the name: %s (flags should be placed before the name)", strings.Join(genCmd.Args()[1:], " "))
+		}
+		genConf, err := newGenConfig(genCmd.Arg(0), genPlural)
+		if err != nil {
+			return err
+		}
+		genConf.WithDB = genWithDB
+		return generate(args[2], genConf)
+	case "dev":
+		devCmd.Parse(args[2:])
+		devConf.Args = devCmd.Args()
+		return dev(devConf)
+	case "migrate":
+		migrateCmd.Parse(args[2:])
+		return migrate(migrateConf)
+	case "validate":
+		validateCmd.Parse(args[2:])
+		return validate(validateConf)
 	default:
 		return errors.New(help(prg))
 	}
@@ -63,7 +128,11 @@ func help(prg string) string {
 	fmt.Fprintf(&b, "Usage: %s COMMAND\n\n", prg)
 	fmt.Fprintf(&b, "Helper to instantiate a bow web project\n\n")
 	fmt.Fprintf(&b, "Commands:\n")
-	fmt.Fprintf(&b, "  init       Initialize a new bow project\n\n")
+	fmt.Fprintf(&b, "  init       Initialize a new bow project\n")
+	fmt.Fprintf(&b, "  dev        Run the project and reload it on changes (development only)\n")
+	fmt.Fprintf(&b, "  gen        Generate a handler scaffold for a resource\n")
+	fmt.Fprintf(&b, "  migrate    Apply pending migrations to a database\n")
+	fmt.Fprintf(&b, "  validate   Check the views of the project for errors\n\n")
 	fmt.Fprintf(&b, "Run %s COMMAND -h for more information on a command", prg)
 	return b.String()
 }
@@ -161,32 +230,38 @@ func createSkeleton(conf initConfig) error {
 			localPath = ".gitignore"
 		}
 
-		if _, err := os.Stat(localPath); err == nil {
-			fmt.Printf("project already contains the file %s, skipping...\n", localPath)
-			return nil
-		}
+		return createFile(skel, path, localPath, conf)
+	})
+	if err != nil {
+		return err
+	}
 
-		tmpl, err := template.New(filepath.Base(path)).Delims("{%", "%}").ParseFS(skel, path)
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		fmt.Printf("creating %s\n", localPath)
+// createFile executes the template file at path from fsys, and writes the
+// result to localPath. It skips the file if it already exists in the project.
+func createFile(fsys embed.FS, path, localPath string, data interface{}) error {
+	if _, err := os.Stat(localPath); err == nil {
+		fmt.Printf("project already contains the file %s, skipping...\n", localPath)
+		return nil
+	}
 
-		f, err := os.Create(localPath)
-		if err != nil {
-			return err
-		}
+	tmpl, err := template.New(filepath.Base(path)).Delims("{%", "%}").ParseFS(fsys, path)
+	if err != nil {
+		return err
+	}
 
-		if err := tmpl.Execute(f, conf); err != nil {
-			return err
-		}
+	fmt.Printf("creating %s\n", localPath)
 
-		return f.Close()
-	})
+	f, err := os.Create(localPath)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := tmpl.Execute(f, data); err != nil {
+		return err
+	}
+
+	return f.Close()
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/lobre/bow"
+)
+
+type migrateConfig struct {
+	DSN        string
+	Migrations string
+	Status     bool
+	Force      bool
+}
+
+// migrate applies pending migrations to the database,
+// or lists applied and pending ones when status is requested.
+func migrate(conf migrateConfig) error {
+	if conf.DSN == "" {
+		return errors.New("please provide a database with -dsn")
+	}
+
+	// migrations are tracked by their path from the project root
+	// so it has to match the one used by the application
+	dir := filepath.ToSlash(filepath.Clean(conf.Migrations))
+	if !fs.ValidPath(dir) {
+		return errors.New("the migrations folder should be relative to the project root")
+	}
+
+	db := bow.NewDB(conf.DSN, os.DirFS("."))
+	db.MigrationsDir = dir
+	db.Force = conf.Force
+	if err := db.Connect(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if conf.Status {
+		applied, pending, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range applied {
+			fmt.Printf("applied  %s\n", name)
+		}
+		for _, name := range pending {
+			fmt.Printf("pending  %s\n", name)
+		}
+
+		return nil
+	}
+
+	applied, err := db.Migrate()
+	for _, name := range applied {
+		fmt.Printf("applied %s\n", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("no pending migrations")
+	}
+
+	return nil
+}
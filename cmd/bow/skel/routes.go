@@ -2,19 +2,17 @@ package main
 
 import (
 	"net/http"
-
-	"github.com/julienschmidt/httprouter"
 )
 
 func (app *application) routes() http.Handler {
 	// middleware chain applied to all dynamic routes
 	dynamic := app.DynChain()
 
-	router := httprouter.New()
-	router.Handler(http.MethodGet, "/assets/*filepath", app.FileServer())
+	router := app.Router()
+	app.Static(router)
 
 	// application routes
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 
-	return app.StdChain().Then(router)
+	return app.Handler(router)
 }
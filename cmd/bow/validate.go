@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/lobre/bow"
+)
+
+type validateConfig struct {
+	Dir        string
+	Extensions string
+	LeftDelim  string
+	RightDelim string
+}
+
+// builtinFuncs are the functions predefined by the template package.
+var builtinFuncs = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true,
+	"len": true, "not": true, "or": true, "print": true, "printf": true, "println": true,
+	"urlquery": true, "eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// validate parses the views of the project in the current directory the same way as the
+// bow package does, and reports parse errors, references to unknown templates, calls to
+// unknown partials and layouts applied from go code that don't exist.
+func validate(conf validateConfig) error {
+	fsys := os.DirFS(".")
+
+	views := bow.NewViews()
+	views.Dir = conf.Dir
+	views.Delims(conf.LeftDelim, conf.RightDelim)
+	if conf.Extensions != "" {
+		views.Extensions(strings.Split(conf.Extensions, ",")...)
+	}
+
+	// funcs registered by the core or the project are not known here
+	funcs, err := usedFuncs(fsys, conf)
+	if err != nil {
+		return err
+	}
+	views.Funcs(funcs)
+
+	if err := views.Parse(fsys); err != nil {
+		return fmt.Errorf("found problem in views: %w", err)
+	}
+
+	pages, partials, texts := views.Templates()
+
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// check reports the templates and partials referenced from a tree that don't exist,
+	// using the name of the view for locations. Templates are not checked if lookup is nil.
+	check := func(tree *parse.Tree, name string, lookup func(string) bool) {
+		walk(tree.Root, func(node parse.Node) {
+			loc := func() string {
+				loc, _ := tree.ErrorContext(node)
+				if tree.ParseName == "main" {
+					loc = name + strings.TrimPrefix(loc, "main")
+				}
+				return loc
+			}
+
+			switch node := node.(type) {
+			case *parse.TemplateNode:
+				if lookup != nil && !lookup(node.Name) {
+					report("%s: template %q not found", loc(), node.Name)
+				}
+			case *parse.CommandNode:
+				if partial, ok := partialCall(node); ok && partials[partial] == nil {
+					report("%s: partial %q not found", loc(), partial)
+				}
+			}
+		})
+	}
+
+	// layouts are parsed with each page, so they are only checked once
+	layouts := make(map[string]bool)
+	checkedLayouts := make(map[string]bool)
+
+	for name, tmpl := range pages {
+		for _, t := range tmpl.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+
+			if t.Tree.ParseName == "main" {
+				check(t.Tree, name, func(name string) bool { return tmpl.Lookup(name) != nil })
+				continue
+			}
+
+			if t.Name() == t.Tree.ParseName {
+				layouts[strings.TrimPrefix(t.Name(), "layouts/")] = true
+			}
+
+			// templates referenced from layouts are defined by pages
+			if !checkedLayouts[t.Name()] {
+				checkedLayouts[t.Name()] = true
+				check(t.Tree, name, nil)
+			}
+		}
+	}
+
+	for name, tmpl := range partials {
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				check(t.Tree, name, func(name string) bool { return tmpl.Lookup(name) != nil })
+			}
+		}
+	}
+
+	for name, tmpl := range texts {
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				check(t.Tree, name, func(name string) bool { return tmpl.Lookup(name) != nil })
+			}
+		}
+	}
+
+	if len(pages) > 0 && !layouts["base"] {
+		report("%s: base layout not found", path.Join(conf.Dir, "layouts"))
+	}
+
+	layoutCalls, err := findLayoutCalls(".")
+	if err != nil {
+		return err
+	}
+	for _, call := range layoutCalls {
+		if !layouts[call.name] {
+			report("%s: layout %q not found", call.pos, call.name)
+		}
+	}
+
+	sort.Strings(problems)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in views", len(problems))
+	}
+
+	fmt.Println("views are valid")
+
+	return nil
+}
+
+// usedFuncs returns placeholders for the functions used in the files of the views folder
+// that are neither builtin nor registered by default, so that parsing does not fail on them.
+func usedFuncs(fsys fs.FS, conf validateConfig) (template.FuncMap, error) {
+	known := make(map[string]bool)
+	for _, name := range bow.NewViews().FuncNames() {
+		known[name] = true
+	}
+
+	funcs := make(template.FuncMap)
+
+	err := fs.WalkDir(fsys, conf.Dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == conf.Dir {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		// parse errors are reported when parsing the views
+		tree := parse.New(path)
+		tree.Mode = parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		if _, err := tree.Parse(string(b), conf.LeftDelim, conf.RightDelim, trees); err != nil {
+			return nil
+		}
+
+		for _, t := range trees {
+			walk(t.Root, func(node parse.Node) {
+				ident, ok := node.(*parse.IdentifierNode)
+				if ok && !known[ident.Ident] && !builtinFuncs[ident.Ident] {
+					funcs[ident.Ident] = func(...interface{}) interface{} { return nil }
+				}
+			})
+		}
+
+		return nil
+	})
+
+	return funcs, err
+}
+
+// walk calls fn for each node of the template tree.
+func walk(node parse.Node, fn func(parse.Node)) {
+	if node == nil {
+		return
+	}
+
+	fn(node)
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			walk(n, fn)
+		}
+	case *parse.ActionNode:
+		walk(node.Pipe, fn)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			walk(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			walk(arg, fn)
+		}
+	case *parse.TemplateNode:
+		walk(node.Pipe, fn)
+	case *parse.IfNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&node.BranchNode, fn)
+	}
+}
+
+// walkBranch walks the pipeline and lists of a branch node.
+func walkBranch(node *parse.BranchNode, fn func(parse.Node)) {
+	walk(node.Pipe, fn)
+	walk(node.List, fn)
+	walk(node.ElseList, fn)
+}
+
+// partialCall returns the name of the partial if the command is
+// a call to the partial func with a literal name.
+func partialCall(cmd *parse.CommandNode) (string, bool) {
+	if len(cmd.Args) < 2 {
+		return "", false
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || ident.Ident != "partial" {
+		return "", false
+	}
+
+	name, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return name.Text, true
+}
+
+// layoutCall is a call to WithLayout or ApplyLayout found in go code.
+type layoutCall struct {
+	pos  token.Position
+	name string
+}
+
+// findLayoutCalls parses the go files of the given directory
+// to find the layouts applied with WithLayout and ApplyLayout.
+func findLayoutCalls(dir string) ([]layoutCall, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []layoutCall
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+
+				var arg ast.Expr
+				switch {
+				case sel.Sel.Name == "ApplyLayout" && len(call.Args) == 1:
+					arg = call.Args[0]
+				case sel.Sel.Name == "WithLayout" && len(call.Args) == 2:
+					arg = call.Args[1]
+				default:
+					return true
+				}
+
+				lit, ok := arg.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+
+				name, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					return true
+				}
+
+				calls = append(calls, layoutCall{pos: fset.Position(lit.Pos()), name: name})
+				return true
+			})
+		}
+	}
+
+	return calls, nil
+}
@@ -0,0 +1,87 @@
+package bow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// LoadEnv populates the struct pointed to by dst from environment variables,
+// using the env struct tags to match fields. A default value can be given,
+// and a variable can be marked as required:
+//
+//	type config struct {
+//		Port  int           `env:"PORT,default=8080"`
+//		DSN   string        `env:"DSN,required"`
+//		Idle  time.Duration `env:"IDLE_TIMEOUT,default=1m"`
+//		Debug bool          `env:"DEBUG"`
+//	}
+//
+// It supports the same types as Form.Scan, plus time.Duration. Variables that are
+// not set leave fields untouched, so that it can complement flag parsing.
+// All the problems are aggregated in the returned error.
+func LoadEnv(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("env destination should be a pointer to a struct")
+	}
+	v = v.Elem()
+
+	var problems []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		tag := field.Tag.Get("env")
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		var def string
+		var hasDef, required bool
+		for _, opt := range strings.Split(opts, ",") {
+			switch {
+			case opt == "required":
+				required = true
+			case strings.HasPrefix(opt, "default="):
+				def, hasDef = strings.TrimPrefix(opt, "default="), true
+			}
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			if required {
+				problems = append(problems, fmt.Sprintf("%s is required", name))
+				continue
+			}
+			if !hasDef {
+				continue
+			}
+			value = def
+		}
+
+		if field.Type == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s is not a valid duration", name))
+				continue
+			}
+			v.Field(i).SetInt(int64(d))
+			continue
+		}
+
+		if msg := scanValue(v.Field(i), value); msg != "" {
+			problems = append(problems, fmt.Sprintf("%s has an invalid value %q for type %s", name, value, field.Type))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("cannot load env: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
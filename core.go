@@ -1,20 +1,31 @@
 package bow
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/gob"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/benbjohnson/hashfs"
 	"github.com/golangcollege/sessions"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
 )
@@ -25,22 +36,64 @@ type Core struct {
 	fsys  fs.FS
 	hfsys *hashfs.FS
 
+	name string
+
 	Logger *log.Logger
 
 	DB      *DB
 	Views   *Views
-	Session *sessions.Session
+	Session SessionStore
+
+	streams *StreamBroadcaster
+
+	translator      *Translator
+	locale          string
+	translatorDebug bool
+	onMissing       func(locale, msg string)
+	translationsDir string
+	csp             map[string]string
+	noIndex         bool
+
+	authKey   string
+	loginPath string
+
+	forceMigrations bool
+	splitMigrations bool
+	migrationsDir   string
+	seed            bool
+
+	pprof bool
+
+	trustedProxies []*net.IPNet
+
+	stdMiddlewares []alice.Constructor // appended to the StdChain
+	dynMiddlewares []alice.Constructor // appended to the DynChain
+
+	assetsDir     string
+	staticPrefix  string
+	staticRouters map[*httprouter.Router]bool
+	mimeTypes     map[string]string // by file extension
+
+	csrfFailure http.Handler
+
+	sriMu     sync.Mutex
+	sriHashes map[string]string
+
+	startTime time.Time
 
-	translator *Translator
-	csp        map[string]string
+	// user-provided funcs applied after built-in ones
+	funcs         template.FuncMap
+	reqFuncs      ReqFuncMap
+	overrideFuncs bool
 }
 
 // NewCore creates a core with sane defaults. Options can be used for specific configurations.
 func NewCore(fsys fs.FS, options ...Option) (*Core, error) {
 	hfsys := hashfs.NewFS(fsys)
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
 	core := &Core{
-		Logger: log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		Logger: logger,
 
 		csp: map[string]string{
 			"default-src": "'self'",
@@ -49,24 +102,40 @@ func NewCore(fsys fs.FS, options ...Option) (*Core, error) {
 		fsys:  fsys,
 		hfsys: hfsys,
 
+		name: filepath.Base(os.Args[0]),
+
 		Views: NewViews(),
-	}
 
-	for _, opt := range options {
-		if err := opt(core); err != nil {
-			return nil, err
-		}
+		funcs:    make(template.FuncMap),
+		reqFuncs: make(ReqFuncMap),
+
+		authKey:   "userID",
+		loginPath: "/login",
+
+		assetsDir:     "assets",
+		staticPrefix:  "/assets",
+		staticRouters: make(map[*httprouter.Router]bool),
+		mimeTypes: map[string]string{
+			".wasm":        "application/wasm",
+			".webmanifest": "application/manifest+json",
+		},
+
+		sriHashes: make(map[string]string),
 	}
 
-	// reapply logger to match the one provided as option
-	core.Views.Logger = core.Logger
+	core.startTime = time.Now()
+	core.streams = NewStreamBroadcaster(core.Views)
 
-	// set default funcs
+	// set default funcs before applying options, so that
+	// the ones of options such as WithTranslator take precedence
 	core.Views.Funcs(template.FuncMap{
 		"hash": hfsys.HashName,
 		"format": func(layout string, dt time.Time) string {
-			return dt.Format(layout)
+			return Format(dt, layout, defaultLocale)
 		},
+		"asset": core.assetURL,
+		"sri":   core.sri,
+		"dict":  dict,
 	})
 
 	// set default req funcs
@@ -76,8 +145,73 @@ func NewCore(fsys fs.FS, options ...Option) (*Core, error) {
 				return nosurf.Token(r)
 			}
 		},
+		"mountpath": func(r *http.Request) interface{} {
+			return func(p string) string {
+				return MountPath(r, p)
+			}
+		},
+		"idempotency_token": func(r *http.Request) interface{} {
+			return func(key string) (template.HTML, error) {
+				return core.idempotencyToken(r, key)
+			}
+		},
+		"timeago": func(r *http.Request) interface{} {
+			return func(t time.Time) string {
+				msg := timeAgo(t, time.Now())
+				if core.translator == nil {
+					return msg
+				}
+				return core.translator.Translate(msg, core.reqLocale(r))
+			}
+		},
 	})
 
+	for _, opt := range options {
+		if err := opt(core); err != nil {
+			return nil, err
+		}
+	}
+
+	if core.DB != nil {
+		core.DB.Force = core.forceMigrations
+		core.DB.SplitStatements = core.splitMigrations
+		if core.migrationsDir != "" {
+			core.DB.MigrationsDir = core.migrationsDir
+		}
+		if err := core.DB.Open(); err != nil {
+			return nil, err
+		}
+
+		if core.seed {
+			if err := core.DB.Seed(); err != nil {
+				return nil, fmt.Errorf("seed: %w", err)
+			}
+		}
+	}
+
+	if core.translator != nil {
+		core.translator.Debug = core.translatorDebug
+		core.translator.OnMissing = core.onMissing
+		if core.translationsDir != "" {
+			core.translator.Dir = core.translationsDir
+		}
+		if err := core.translator.Parse(core.fsys); err != nil {
+			return nil, err
+		}
+	}
+
+	// identify the application in logs, but leave a logger provided as option untouched
+	if core.Logger == logger && core.name != "" {
+		core.Logger.SetPrefix(core.name + ": ")
+	}
+
+	// reapply logger to match the one provided as option
+	core.Views.Logger = core.Logger
+
+	if err := core.applyFuncs(); err != nil {
+		return nil, err
+	}
+
 	if err := core.Views.Parse(fsys); err != nil {
 		return nil, err
 	}
@@ -85,6 +219,21 @@ func NewCore(fsys fs.FS, options ...Option) (*Core, error) {
 	return core, nil
 }
 
+// ReloadTranslations parses the translation files of the filesystem again, as with
+// Translator.Reload, such as after translators have edited them. Files embedded in the
+// binary cannot change, so the core should be created with a filesystem such as os.DirFS.
+func (core *Core) ReloadTranslations() error {
+	if core.translator == nil {
+		return errors.New("translator is not enabled")
+	}
+	return core.translator.Reload(core.fsys)
+}
+
+// Name returns the name of the application, as set with WithName.
+func (core *Core) Name() string {
+	return core.name
+}
+
 // Option configures a core.
 type Option func(*Core) error
 
@@ -96,17 +245,52 @@ func WithLogger(logger *log.Logger) Option {
 	}
 }
 
+// WithName is an option to set the name of the application. It prefixes
+// log lines, unless a logger is provided with WithLogger. By default, the name
+// of the binary is used.
+func WithName(name string) Option {
+	return func(core *Core) error {
+		core.name = name
+		return nil
+	}
+}
+
 // WithCSP is an option to set the csp rules that will be set on http responses.
-// By default, only default-src : 'self' is defined.
+// By default, only default-src : 'self' is defined. A directive with an empty
+// value is removed from the rules.
 func WithCSP(csp map[string]string) Option {
 	return func(core *Core) error {
 		for k, v := range csp {
+			if v == "" {
+				delete(core.csp, k)
+				continue
+			}
 			core.csp[k] = v
 		}
 		return nil
 	}
 }
 
+// WithoutCSP is an option to remove all the csp rules, so that no
+// Content-Security-Policy header is set on http responses. It is useful
+// when a proxy in front of the application already sets its own.
+func WithoutCSP() Option {
+	return func(core *Core) error {
+		core.csp = make(map[string]string)
+		return nil
+	}
+}
+
+// WithNoIndex is an option to ask search engines not to index the application,
+// by setting the X-Robots-Tag header on all http responses. It is useful for
+// staging environments. The NoIndex middleware can be used for specific routes instead.
+func WithNoIndex(noIndex bool) Option {
+	return func(core *Core) error {
+		core.noIndex = noIndex
+		return nil
+	}
+}
+
 // WithDebug is an option to spit the server errors directly in
 // http responses, instead of a generic 'Internal Server Error' message.
 func WithDebug(debug bool) Option {
@@ -116,13 +300,176 @@ func WithDebug(debug bool) Option {
 	}
 }
 
+// WithPprof is an option to allow RegisterPprof to expose
+// the profiling endpoints, even when debug is disabled.
+func WithPprof(enable bool) Option {
+	return func(core *Core) error {
+		core.pprof = enable
+		return nil
+	}
+}
+
+// WithViewExtensions is an option to change the file extensions of views,
+// layouts and partials, such as .gohtml instead of .html. Their names are
+// then resolved without the matched extension.
+func WithViewExtensions(exts ...string) Option {
+	return func(core *Core) error {
+		core.Views.Extensions(exts...)
+		return nil
+	}
+}
+
+// WithTrustedProxies is an option to define the networks of the proxies in front
+// of the application, such as "10.0.0.0/8" or a single address like "127.0.0.1".
+// Forwarded headers are only honored by ClientIP and Scheme for requests coming from them.
+func WithTrustedProxies(cidrs ...string) Option {
+	return func(core *Core) error {
+		for _, cidr := range cidrs {
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy: %w", err)
+			}
+
+			core.trustedProxies = append(core.trustedProxies, network)
+		}
+		return nil
+	}
+}
+
+// WithStaticPrefix is an option to change the url prefix under which Static serves
+// the files of the assets folder, which is "/assets" by default.
+func WithStaticPrefix(prefix string) Option {
+	return func(core *Core) error {
+		core.staticPrefix = "/" + strings.Trim(prefix, "/")
+		return nil
+	}
+}
+
+// WithCSRFFailureHandler is an option to define the handler called
+// when the CSRF check of a request fails. The reason of the failure
+// can be retrieved in the handler using nosurf.Reason.
+func WithCSRFFailureHandler(h http.Handler) Option {
+	return func(core *Core) error {
+		core.csrfFailure = h
+		return nil
+	}
+}
+
+// WithMIMETypes is an option to override the content types of files served by FileServer
+// depending on their extension, such as ".wasm" to "application/wasm". By default, the types
+// of .wasm and .webmanifest files are already overridden, as they are required by browsers.
+func WithMIMETypes(types map[string]string) Option {
+	return func(core *Core) error {
+		for ext, typ := range types {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			core.mimeTypes[strings.ToLower(ext)] = typ
+		}
+		return nil
+	}
+}
+
+// WithTemplateDelims is an option to change the action delimiters used
+// to parse views, layouts and partials. It is useful to avoid conflicts
+// with frontend frameworks that also rely on {{ and }}.
+func WithTemplateDelims(left, right string) Option {
+	return func(core *Core) error {
+		core.Views.Delims(left, right)
+		return nil
+	}
+}
+
 // WithDB is an option to enable and configure the database access.
+// The database is opened and migrated once all options have been applied.
 func WithDB(dsn string) Option {
 	return func(core *Core) error {
 		core.DB = NewDB(dsn, core.fsys)
-		if err := core.DB.Open(); err != nil {
-			return err
+		return nil
+	}
+}
+
+// WithForceMigrations is an option to allow migrating the database even if
+// already applied migration files have been modified. It should only be used
+// to recover from an intentional modification.
+func WithForceMigrations(force bool) Option {
+	return func(core *Core) error {
+		core.forceMigrations = force
+		return nil
+	}
+}
+
+// WithSplitMigrations is an option to execute the statements of migration files one by one
+// within their transaction, which reports the failing statement in case of error.
+func WithSplitMigrations(split bool) Option {
+	return func(core *Core) error {
+		core.splitMigrations = split
+		return nil
+	}
+}
+
+// WithMigrationsDir is an option to change the folder containing the migration files,
+// which is "migrations" by default. The path is relative to the root of the filesystem.
+func WithMigrationsDir(dir string) Option {
+	return func(core *Core) error {
+		if !fs.ValidPath(dir) {
+			return fmt.Errorf("migrations dir %s is not valid", dir)
 		}
+		core.migrationsDir = dir
+		return nil
+	}
+}
+
+// WithSeed is an option to execute the pending seed files of the seeds folder
+// once migrations have been applied. It allows production to opt out of sample data.
+func WithSeed(seed bool) Option {
+	return func(core *Core) error {
+		core.seed = seed
+		return nil
+	}
+}
+
+// WithViewsDir is an option to change the folder containing the views,
+// which is "views" by default. The path is relative to the root of the filesystem.
+func WithViewsDir(dir string) Option {
+	return func(core *Core) error {
+		if !fs.ValidPath(dir) {
+			return fmt.Errorf("views dir %s is not valid", dir)
+		}
+		core.Views.Dir = dir
+		return nil
+	}
+}
+
+// WithTranslationsDir is an option to change the folder containing the translation files,
+// which is "translations" by default. The path is relative to the root of the filesystem.
+func WithTranslationsDir(dir string) Option {
+	return func(core *Core) error {
+		if !fs.ValidPath(dir) {
+			return fmt.Errorf("translations dir %s is not valid", dir)
+		}
+		core.translationsDir = dir
+		return nil
+	}
+}
+
+// WithAssetsDir is an option to change the folder containing the static files,
+// which is "assets" by default. The path is relative to the root of the filesystem.
+// The url prefix under which they are served can be changed with WithStaticPrefix.
+func WithAssetsDir(dir string) Option {
+	return func(core *Core) error {
+		if !fs.ValidPath(dir) || dir == "." {
+			return fmt.Errorf("assets dir %s is not valid", dir)
+		}
+		core.assetsDir = dir
 		return nil
 	}
 }
@@ -134,9 +481,7 @@ func WithDB(dsn string) Option {
 func WithTranslator(locale string) Option {
 	return func(core *Core) error {
 		core.translator = NewTranslator()
-		if err := core.translator.Parse(core.fsys); err != nil {
-			return err
-		}
+		core.locale = locale
 
 		if locale != "auto" {
 			core.Views.Funcs(template.FuncMap{
@@ -146,6 +491,12 @@ func WithTranslator(locale string) Option {
 				"lang": func() string {
 					return core.translator.langFromLocale(locale)
 				},
+				"rtl": func() bool {
+					return core.translator.IsRTL(locale)
+				},
+				"dir": func() string {
+					return core.translator.dir(locale)
+				},
 				"format": func(layout string, dt time.Time) string {
 					return Format(dt, layout, locale)
 				},
@@ -162,6 +513,16 @@ func WithTranslator(locale string) Option {
 						return core.translator.langFromLocale(core.translator.ReqLocale(r))
 					}
 				},
+				"rtl": func(r *http.Request) interface{} {
+					return func() bool {
+						return core.translator.IsRTL(core.translator.ReqLocale(r))
+					}
+				},
+				"dir": func(r *http.Request) interface{} {
+					return func() string {
+						return core.translator.dir(core.translator.ReqLocale(r))
+					}
+				},
 				"format": func(r *http.Request) interface{} {
 					return func(layout string, dt time.Time) string {
 						return Format(dt, layout, core.translator.ReqLocale(r))
@@ -174,18 +535,53 @@ func WithTranslator(locale string) Option {
 	}
 }
 
+// WithTranslatorDebug is an option to record the messages that could not be
+// translated, so that they can be listed with MissingTranslations. It should
+// not be enabled in production.
+func WithTranslatorDebug(debug bool) Option {
+	return func(core *Core) error {
+		core.translatorDebug = debug
+		return nil
+	}
+}
+
+// WithMissingTranslation is an option to register a function called each time
+// a message falls back to its untranslated version, such as to log it during testing.
+func WithMissingTranslation(fn func(locale, msg string)) Option {
+	return func(core *Core) error {
+		core.onMissing = fn
+		return nil
+	}
+}
+
 // WithSession is an option to enable cookie sessions.
 // The key parameter is the secret you want to use to authenticate
 // and encrypt sessions cookies, and should be 32 bytes long.
 func WithSession(key string) Option {
 	return func(core *Core) error {
-		core.Session = sessions.New([]byte(key))
-		core.Session.Lifetime = 12 * time.Hour
+		session := sessions.New([]byte(key))
+		session.Lifetime = 12 * time.Hour
+
+		return WithSessionStore(session)(core)
+	}
+}
+
+// WithSessionStore is an option to enable sessions using a custom store,
+// such as one persisting sessions in a database instead of in cookies.
+func WithSessionStore(store SessionStore) Option {
+	return func(core *Core) error {
+		core.Session = store
 
 		core.Views.ReqFuncs(ReqFuncMap{
 			"flash": func(r *http.Request) interface{} {
 				return func() string {
-					return core.Session.PopString(r, "flash")
+					return core.popFlash(r)
+				}
+			},
+			"flashes": func(r *http.Request) interface{} {
+				return func() []FlashMessage {
+					flashes, _ := core.Session.Pop(r, "flashes").([]FlashMessage)
+					return flashes
 				}
 			},
 		})
@@ -194,12 +590,25 @@ func WithSession(key string) Option {
 	}
 }
 
+// WithAuth is an option to configure the session key holding the id of
+// the authenticated user, and the path unauthenticated users are redirected to.
+// By default, they are "userID" and "/login".
+func WithAuth(key, loginPath string) Option {
+	return func(core *Core) error {
+		core.authKey = key
+		core.loginPath = loginPath
+		return nil
+	}
+}
+
 // WithFuncs is an option to configure default functions that will
-// be injected into views.
+// be injected into views. They replace the built-in helpers of the same name,
+// such as "title" or "add", but an error is returned when creating the core if one
+// of them collides with a reserved built-in function, unless WithOverrideFuncs is used.
 func WithFuncs(funcs template.FuncMap) Option {
 	return func(core *Core) error {
 		for k, fn := range funcs {
-			core.Views.funcs[k] = fn
+			core.funcs[k] = fn
 		}
 		return nil
 	}
@@ -210,12 +619,32 @@ func WithFuncs(funcs template.FuncMap) Option {
 func WithReqFuncs(funcs ReqFuncMap) Option {
 	return func(core *Core) error {
 		for k, fn := range funcs {
-			core.Views.reqFuncs[k] = fn
+			core.reqFuncs[k] = fn
 		}
 		return nil
 	}
 }
 
+// WithOverrideFuncs is an option to allow functions defined with WithFuncs
+// and WithReqFuncs to intentionally replace built-in functions.
+func WithOverrideFuncs(override bool) Option {
+	return func(core *Core) error {
+		core.overrideFuncs = override
+		return nil
+	}
+}
+
+// WithRenderObserver is an option to register a function that is called after
+// each successful render with the view name, the size of the output in bytes
+// and the duration of the render. It can be used to collect metrics.
+// Partials rendered from within a view are reported too.
+func WithRenderObserver(fn func(name string, bytes int, dur time.Duration)) Option {
+	return func(core *Core) error {
+		core.Views.observer = fn
+		return nil
+	}
+}
+
 // WithGlobals is an option that allows to define a function that is
 // called at each rendering to inject data that can be retrieved using the
 // "globals" helper template function.
@@ -232,39 +661,278 @@ func WithGlobals(fn func(*http.Request) interface{}) Option {
 	}
 }
 
+// reservedFuncs are the built-in funcs the framework relies on, which cannot be replaced
+// with WithFuncs and WithReqFuncs unless WithOverrideFuncs is used. Other built-in funcs,
+// such as the helpers of NewViews, are defaults that user-provided funcs replace.
+var reservedFuncs = map[string]bool{
+	"safe":              true,
+	"partial":           true,
+	"data":              true,
+	"csrf":              true,
+	"hash":              true,
+	"asset":             true,
+	"sri":               true,
+	"mountpath":         true,
+	"idempotency_token": true,
+	"format":            true,
+	"translate":         true,
+	"lang":              true,
+	"rtl":               true,
+	"dir":               true,
+	"flash":             true,
+	"flashes":           true,
+	"globals":           true,
+}
+
+// applyFuncs injects user-provided funcs into views. It returns an error
+// listing the funcs colliding with reserved built-in ones, unless overrides are allowed.
+func (core *Core) applyFuncs() error {
+	if !core.overrideFuncs {
+		var conflicts []string
+		for k := range core.funcs {
+			if _, ok := core.Views.funcs[k]; ok && reservedFuncs[k] {
+				conflicts = append(conflicts, k)
+			}
+		}
+		for k := range core.reqFuncs {
+			if _, ok := core.Views.funcs[k]; ok && reservedFuncs[k] {
+				conflicts = append(conflicts, k)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return fmt.Errorf("funcs collide with built-in ones: %s", strings.Join(conflicts, ", "))
+		}
+	}
+
+	// a regular func replacing a request-aware one should not be redefined at rendering
+	for k := range core.funcs {
+		delete(core.Views.reqFuncs, k)
+	}
+
+	core.Views.Funcs(core.funcs)
+	core.Views.ReqFuncs(core.reqFuncs)
+
+	return nil
+}
+
 // FileServer returns a handler for serving filesystem files.
 // It enforces http cache by appending hashes to filenames.
 // A hashName function is defined in templates to gather the hashed filename of a file.
+// The content type of files is derived from their extension,
+// and can be overridden using WithMIMETypes.
 func (core *Core) FileServer() http.Handler {
-	return hashfs.FileServer(core.hfsys)
+	fileServer := hashfs.FileServer(core.hfsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.setMIMEType(w, r.URL.Path)
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// setMIMEType sets the content type of the response if it is overridden
+// for the extension of the file. http.ServeContent keeps a preset content type.
+func (core *Core) setMIMEType(w http.ResponseWriter, name string) {
+	if typ, ok := core.mimeTypes[strings.ToLower(path.Ext(name))]; ok {
+		w.Header().Set("Content-Type", typ)
+	}
+}
+
+// NotFound returns a handler responding with a 404 Not Found, rendered
+// with the errors views if they exist as described in RenderError.
+func (core *Core) NotFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.Views.RenderError(w, r, http.StatusNotFound, nil)
+	})
+}
+
+// MethodNotAllowed returns a handler responding with a 405 Method Not Allowed, rendered
+// with the errors views if they exist as described in RenderError. The Allow header
+// listing the methods of the route is set by httprouter before calling it.
+func (core *Core) MethodNotAllowed() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.Views.RenderError(w, r, http.StatusMethodNotAllowed, nil)
+	})
+}
+
+// HandleErrors configures the router to respond with NotFound and MethodNotAllowed
+// when a request does not match any route.
+func (core *Core) HandleErrors(router *httprouter.Router) {
+	router.HandleMethodNotAllowed = true
+	router.NotFound = core.NotFound()
+	router.MethodNotAllowed = core.MethodNotAllowed()
+}
+
+// Router returns a new router whose error paths are handled by the framework, so that
+// they behave like regular routes. Unknown routes are handled with NotFound, wrong methods
+// with MethodNotAllowed, and panics are logged and answered as in the StdChain.
+func (core *Core) Router() *httprouter.Router {
+	router := httprouter.New()
+	core.HandleErrors(router)
+
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		// make the http.Server automatically close the current connection.
+		w.Header().Set("Connection", "close")
+		core.Views.ServerError(w, fmt.Errorf("%s", err))
+	}
+
+	return router
+}
+
+// Static registers on the router the route serving the files of the assets folder with
+// FileServer, under the prefix configured with WithStaticPrefix. Calling it several times
+// on the same router has no effect. In templates, the "asset" func returns the url
+// of a file of the assets folder, such as {{ asset "style.css" }}.
+func (core *Core) Static(router *httprouter.Router) {
+	if core.staticRouters[router] {
+		return
+	}
+	core.staticRouters[router] = true
+
+	fileServer := core.FileServer()
+
+	router.Handler(http.MethodGet, core.staticPrefix+"/*filepath", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// map the url prefix to the assets folder of the filesystem
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + core.assetsDir + "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, core.staticPrefix), "/")
+		r2.URL.RawPath = ""
+		fileServer.ServeHTTP(w, r2)
+	}))
+}
+
+// ServeRootFiles registers on the router routes serving files of the filesystem from the root
+// path, such as "assets/favicon.ico" served at /favicon.ico, as browsers and crawlers expect
+// some files there. The content type is derived from the extension, and as their names are
+// not hashed, the files are cached for a day only.
+func (core *Core) ServeRootFiles(router *httprouter.Router, files ...string) {
+	for _, file := range files {
+		file := file
+
+		router.HandlerFunc(http.MethodGet, "/"+path.Base(file), func(w http.ResponseWriter, r *http.Request) {
+			b, err := fs.ReadFile(core.fsys, file)
+			if err != nil {
+				core.Views.RenderError(w, r, http.StatusNotFound, nil)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			core.setMIMEType(w, file)
+			http.ServeContent(w, r, path.Base(file), time.Time{}, bytes.NewReader(b))
+		})
+	}
+}
+
+// assetURL returns the url of a file of the assets folder, with its hash for caching.
+func (core *Core) assetURL(name string) string {
+	hashed := core.hfsys.HashName(path.Join(core.assetsDir, name))
+	return core.staticPrefix + "/" + strings.TrimPrefix(hashed, core.assetsDir+"/")
+}
+
+// AssetManifest returns the mapping of the files of the assets folder to their
+// hashed names, relative to the assets folder, such as "css/app.css" to
+// "css/app-abcd1234.css". It can be exported to upload hashed files to a CDN.
+func (core *Core) AssetManifest() (map[string]string, error) {
+	manifest := make(map[string]string)
+
+	if _, err := fs.Stat(core.fsys, core.assetsDir); errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+
+	prefix := core.assetsDir + "/"
+
+	err := fs.WalkDir(core.fsys, core.assetsDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		manifest[strings.TrimPrefix(name, prefix)] = strings.TrimPrefix(core.hfsys.HashName(name), prefix)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// sri returns the subresource integrity hash of a file of the filesystem, to be used in
+// the integrity attribute of script and link tags, such as {{ sri "assets/app.js" }}.
+// Hashes are computed once per file.
+func (core *Core) sri(name string) (string, error) {
+	core.sriMu.Lock()
+	defer core.sriMu.Unlock()
+
+	if hash, ok := core.sriHashes[name]; ok {
+		return hash, nil
+	}
+
+	b, err := fs.ReadFile(core.fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha512.Sum384(b)
+	hash := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	core.sriHashes[name] = hash
+
+	return hash, nil
 }
 
 // StdChain returns a chain of middleware that can be applied to all routes.
 // It gracefully handles panics to avoid spinning down the whole app.
-// It logs requests and add default secure headers.
+// It logs requests and add default secure headers. HEAD requests are
+// answered by GET routes without sending the body.
 func (core *Core) StdChain() alice.Chain {
 	return alice.New(
 		core.recoverPanic,
 		core.logRequest,
 		core.secureHeaders,
 		methodOverride,
-	)
+		headAsGet,
+	).Append(core.stdMiddlewares...)
+}
+
+// Use registers middlewares that are appended to the StdChain, so that they
+// apply to all routes. They run in registration order, after the default ones.
+// It should be called at startup, before the chain is built.
+func (core *Core) Use(m ...alice.Constructor) {
+	core.stdMiddlewares = append(core.stdMiddlewares, m...)
+}
+
+// UseDyn registers middlewares that are appended to the DynChain, so that they
+// apply to all dynamic routes. They run in registration order, after the default ones.
+// It should be called at startup, before the chain is built.
+func (core *Core) UseDyn(m ...alice.Constructor) {
+	core.dynMiddlewares = append(core.dynMiddlewares, m...)
+}
+
+// Handler wraps the router with the StdChain. It is the recommended entry point to
+// pass to the http server, so that middlewares added to the standard chain in future
+// versions are automatically applied.
+func (core *Core) Handler(router http.Handler) http.Handler {
+	return core.StdChain().Then(router)
 }
 
 // DynChain returns a chain of middleware that can be applied to all dynamic routes.
-// It injects a CSRF cookie and enable sessions.
+// It injects a CSRF cookie and enable sessions. It also prevents responses from being
+// cached, which can be reverted for a specific route using AllowCache.
 func (core *Core) DynChain() alice.Chain {
-	chain := alice.New(injectCSRF)
+	chain := alice.New(noCache, core.injectCSRF)
 	if core.Session != nil {
 		chain = chain.Append(core.Session.Enable)
 	}
-	return chain
+	return chain.Append(core.dynMiddlewares...)
 }
 
 // logRequest is a middleware that logs the request to the application logger.
 func (core *Core) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		core.Logger.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+		core.Logger.Printf("%s - %s %s %s", core.ClientIP(r), r.Proto, r.Method, r.URL.RequestURI())
 		next.ServeHTTP(w, r)
 	})
 }
@@ -292,17 +960,110 @@ func (core *Core) recoverPanic(next http.Handler) http.Handler {
 // to prevent XSS and Clickjacking attacks.
 func (core *Core) secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var b strings.Builder
-		for k, v := range core.csp {
-			fmt.Fprintf(&b, "%s %s; ", k, v)
-		}
+		if len(core.csp) > 0 {
+			var b strings.Builder
+			for k, v := range core.csp {
+				fmt.Fprintf(&b, "%s %s; ", k, v)
+			}
 
-		w.Header().Set("Content-Security-Policy", strings.TrimSpace(b.String()))
+			w.Header().Set("Content-Security-Policy", strings.TrimSpace(b.String()))
+		}
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
 		w.Header().Set("X-XSS-Protection", "0")
+		if core.noIndex {
+			w.Header().Set("X-Robots-Tag", robotsNoIndex)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headAsGet is a middleware that serves HEAD requests with the GET handlers, so that
+// routes don't have to be registered twice. The body is discarded, but its length is
+// used for the Content-Length header. As a consequence, routes registered for the HEAD
+// method are never reached.
+func headAsGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// a copy keeps the server aware that it is a HEAD request
+		r2 := r.WithContext(r.Context())
+		r2.Method = http.MethodGet
+
+		hw := &headWriter{ResponseWriter: w}
+		next.ServeHTTP(hw, r2)
+		hw.flush()
+	})
+}
+
+// headWriter discards the body of a response and counts its length. The headers
+// are only sent at the end, once the Content-Length is known.
+type headWriter struct {
+	http.ResponseWriter
+	status int
+	length int
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
 
+func (hw *headWriter) Write(b []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.length += len(b)
+	return len(b), nil
+}
+
+func (hw *headWriter) flush() {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+
+	if hw.Header().Get("Content-Length") == "" && hw.length > 0 {
+		hw.Header().Set("Content-Length", strconv.Itoa(hw.length))
+	}
+
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
+
+// noCache is a middleware that prevents browsers and intermediaries from caching
+// the response, so that the back button cannot show the page of a previous user.
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// robotsNoIndex is the value of the X-Robots-Tag header preventing indexing.
+const robotsNoIndex = "noindex, nofollow"
+
+// NoIndex is a middleware that asks search engines not to index the response
+// and not to follow its links, by setting the X-Robots-Tag header.
+func NoIndex(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", robotsNoIndex)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowCache is a middleware that removes the cache headers set by the DynChain,
+// for dynamic routes whose responses can safely be cached. Handlers can then
+// define their own Cache-Control header.
+func AllowCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Pragma")
 		next.ServeHTTP(w, r)
 	})
 }
@@ -331,12 +1092,64 @@ func methodOverride(next http.Handler) http.Handler {
 	})
 }
 
+// RedirectTrailingSlash is a middleware that permanently redirects GET and HEAD
+// requests having a trailing slash to the same path without it, as httprouter
+// treats them as distinct routes. The root path and the assets served under the
+// static prefix are left untouched.
+func (core *Core) RedirectTrailingSlash(next http.Handler) http.Handler {
+	return core.trailingSlash(next, false)
+}
+
+// AppendTrailingSlash is the opposite of RedirectTrailingSlash. It permanently
+// redirects GET and HEAD requests without a trailing slash to the same path with it.
+func (core *Core) AppendTrailingSlash(next http.Handler) http.Handler {
+	return core.trailingSlash(next, true)
+}
+
+// trailingSlash redirects to the canonical form of the path, with or without trailing slash.
+func (core *Core) trailingSlash(next http.Handler, add bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			path == "/" || strings.HasPrefix(path, core.staticPrefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// collapse leading slashes to prevent redirecting to another host
+		canonical := "/" + strings.Trim(path, "/")
+		if add {
+			canonical += "/"
+		}
+
+		if canonical == path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u := *r.URL
+		u.Path = canonical
+		u.RawPath = ""
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
 // injectCSRF is a middleware that injects an encrypted CSRF token in a cookie.
 // That same token is used as a hidden field in forms (from nosurf.Token()).
 // On the form submission, the server checks that these two values match.
 // So directly trying to post a request to our secured endpoint without this parameter would fail.
 // The only way to submit the form is from our frontend.
-func injectCSRF(next http.Handler) http.Handler {
+// When the check fails, the handler set with WithCSRFFailureHandler is called.
+// By default, the errors/400 view is rendered, or a message telling that the session
+// has expired if there is none.
+func (core *Core) injectCSRF(next http.Handler) http.Handler {
+	return core.newCSRFHandler(next)
+}
+
+// newCSRFHandler creates the nosurf handler with the cookie configuration
+// shared by injectCSRF and RotateCSRF.
+func (core *Core) newCSRFHandler(next http.Handler) *nosurf.CSRFHandler {
 	handler := nosurf.New(next)
 
 	handler.SetBaseCookie(http.Cookie{
@@ -345,16 +1158,116 @@ func injectCSRF(next http.Handler) http.Handler {
 		Secure:   true,
 	})
 
-	handler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "CSRF Validation Failed", http.StatusBadRequest)
-	}))
+	if core.csrfFailure != nil {
+		handler.SetFailureHandler(core.csrfFailure)
+	} else {
+		handler.SetFailureHandler(http.HandlerFunc(core.csrfFailed))
+	}
 
 	return handler
 }
 
-// Flash sets a flash message to the session.
+// csrfFailed is the default handler called when the CSRF check fails. It most likely
+// happens when a form has been left open until the session expired.
+func (core *Core) csrfFailed(w http.ResponseWriter, r *http.Request) {
+	if core.Views.hasErrorView(http.StatusBadRequest) {
+		core.Views.RenderError(w, r, http.StatusBadRequest, nosurf.Reason(r))
+		return
+	}
+
+	http.Error(w, "Your session has expired, please refresh the page and try again", http.StatusBadRequest)
+}
+
+// RotateCSRF generates a new CSRF token, and replaces the cookie set by injectCSRF.
+// It should be called after a privilege change such as a login, to prevent an attacker
+// from fixing the token beforehand. The new token is directly available to the csrf
+// template func for the rest of the request. It only works on routes of the DynChain,
+// and does nothing otherwise.
+func (core *Core) RotateCSRF(w http.ResponseWriter, r *http.Request) {
+	if nosurf.Token(r) == "" {
+		return
+	}
+
+	core.newCSRFHandler(nil).RegenerateToken(w, r)
+}
+
+// MissingTranslations returns the messages that could not be translated for the given
+// locale. It requires the translator to be enabled in debug mode using WithTranslatorDebug.
+func (core *Core) MissingTranslations(locale string) []string {
+	if core.translator == nil {
+		return nil
+	}
+	return core.translator.Missing(locale)
+}
+
+// LocalizeForm translates the error messages of the form into the locale of the request,
+// as configured with WithTranslator. It does nothing when there is no translator.
+func (core *Core) LocalizeForm(r *http.Request, form *Form) {
+	form.Localize(core.translator, core.reqLocale(r))
+}
+
+// reqLocale returns the locale to use for the request.
+// It is the locale configured with WithTranslator, or the one retrieved from
+// the request if it is set to "auto". It returns the default locale if there
+// is no translator.
+func (core *Core) reqLocale(r *http.Request) string {
+	switch {
+	case core.translator == nil:
+		return defaultLocale
+	case core.locale == "auto":
+		return core.translator.ReqLocale(r)
+	default:
+		return core.locale
+	}
+}
+
+// Flash queues a flash message to the session with the info level.
+// The first queued message can be retrieved in templates using the "flash" function,
+// and all of them using the "flashes" function.
 func (core *Core) Flash(r *http.Request, msg string) {
-	core.Session.Put(r, "flash", msg)
+	core.FlashLevel(r, FlashInfo, msg)
+}
+
+// Flash levels that can be used with FlashLevel.
+const (
+	FlashSuccess = "success"
+	FlashInfo    = "info"
+	FlashError   = "error"
+)
+
+// FlashMessage is a flash message associated with a severity level
+// that can be used to style it.
+type FlashMessage struct {
+	Level   string
+	Message string
+}
+
+func init() {
+	// register the type to allow storing it in the session
+	gob.Register([]FlashMessage{})
+}
+
+// FlashLevel queues a flash message with a severity level to the session.
+// All the queued messages can be retrieved in templates using the "flashes" function.
+func (core *Core) FlashLevel(r *http.Request, level, msg string) {
+	flashes, _ := core.Session.Get(r, "flashes").([]FlashMessage)
+	core.Session.Put(r, "flashes", append(flashes, FlashMessage{Level: level, Message: msg}))
+}
+
+// popFlash removes the first queued flash message from the session and returns it.
+func (core *Core) popFlash(r *http.Request) string {
+	flashes, _ := core.Session.Get(r, "flashes").([]FlashMessage)
+	if len(flashes) == 0 {
+		return ""
+	}
+
+	if len(flashes) == 1 {
+		core.Session.Remove(r, "flashes")
+	} else {
+		core.Session.Put(r, "flashes", flashes[1:])
+	}
+
+	return flashes[0].Message
 }
 
 // Run runs the http server and launches a goroutine
@@ -1,8 +1,17 @@
 package bow
 
 import (
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
+
+	"github.com/justinas/alice"
 )
 
 func TestBuild(t *testing.T) {
@@ -16,3 +25,168 @@ func TestBuild(t *testing.T) {
 		t.Fatalf("cannot create core: %v", err)
 	}
 }
+
+func TestFuncsCollision(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/index.html": {
+			Data: []byte("hello, world"),
+		},
+	}
+
+	funcs := template.FuncMap{
+		"safe": func(s string) string { return s },
+	}
+
+	if _, err := NewCore(fs, WithFuncs(funcs)); err == nil {
+		t.Fatal("expected an error for a func colliding with a built-in one")
+	}
+
+	if _, err := NewCore(fs, WithFuncs(funcs), WithOverrideFuncs(true)); err != nil {
+		t.Fatalf("cannot create core with overridden funcs: %v", err)
+	}
+
+	helpers := template.FuncMap{
+		"add":   func(a, b string) string { return a + b },
+		"title": func(s string) string { return s },
+	}
+
+	if _, err := NewCore(fs, WithFuncs(helpers)); err != nil {
+		t.Fatalf("cannot create core replacing built-in helpers: %v", err)
+	}
+}
+
+func TestBuildWithoutViews(t *testing.T) {
+	fs := fstest.MapFS{
+		"assets/style.css": {
+			Data: []byte("body {}"),
+		},
+	}
+
+	if _, err := NewCore(fs); err != nil {
+		t.Fatalf("cannot create core without views: %v", err)
+	}
+}
+
+func TestCustomDirs(t *testing.T) {
+	fs := fstest.MapFS{
+		"web/templates/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"web/templates/users/index.html": {
+			Data: []byte(`{{ define "main" }}{{ translate "Hello" }}{{ end }}`),
+		},
+		"web/i18n/fr_FR.csv": {
+			Data: []byte("Hello,Bonjour\n"),
+		},
+	}
+
+	core, err := NewCore(fs,
+		WithViewsDir("web/templates"),
+		WithTranslator("fr_FR"),
+		WithTranslationsDir("web/i18n"),
+	)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	core.Views.Render(w, httptest.NewRequest("GET", "/", nil), 200, "users/index", nil)
+
+	if got := w.Body.String(); got != "Bonjour" {
+		t.Fatalf("got %q, want %q", got, "Bonjour")
+	}
+}
+
+func TestTranslatorFormat(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"views/date.html": {
+			Data: []byte(`{{ define "main" }}{{ format "date.long" . }}{{ end }}`),
+		},
+		"translations/fr_FR.csv": {
+			Data: []byte(""),
+		},
+	}
+
+	core, err := NewCore(fs, WithTranslator("fr_FR"))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	core.Views.Render(w, httptest.NewRequest("GET", "/", nil), 200, "date", time.Date(2022, time.March, 14, 0, 0, 0, 0, time.UTC))
+
+	if got, want := w.Body.String(), "14 mars 2022"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoggerPrefix(t *testing.T) {
+	core, err := NewCore(fstest.MapFS{}, WithName("app"))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	if got := core.Logger.Prefix(); got != "app: " {
+		t.Fatalf("got prefix %q for the default logger, want %q", got, "app: ")
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	if _, err := NewCore(fstest.MapFS{}, WithName("app"), WithLogger(logger)); err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	if got := logger.Prefix(); got != "" {
+		t.Fatalf("expected the provided logger to be left untouched, got prefix %q", got)
+	}
+}
+
+func TestUse(t *testing.T) {
+	core, err := NewCore(fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	var order []string
+	middleware := func(name string) alice.Constructor {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	core.Use(middleware("first"), middleware("second"))
+	core.UseDyn(middleware("dyn"))
+
+	handler := core.StdChain().Extend(core.DynChain()).ThenFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(order, ","); got != "first,second,dyn" {
+		t.Fatalf("got middlewares %q, want them in registration order", got)
+	}
+}
+
+func TestAppendTrailingSlashStaticPrefix(t *testing.T) {
+	core, err := NewCore(fstest.MapFS{}, WithStaticPrefix("/static"))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	handler := core.AppendTrailingSlash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for path, want := range map[string]int{
+		"/static/app-abcd.css": http.StatusOK,
+		"/users":               http.StatusMovedPermanently,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != want {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bow
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests, such as
+	// "https://example.com". An origin can contain a wildcard for subdomains, such as
+	// "https://*.example.com", and "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed for cross-origin requests.
+	// It defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed for cross-origin requests,
+	// in addition to the ones always allowed by browsers. "*" allows all headers.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that the client is allowed to read,
+	// in addition to the ones always exposed by browsers.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with cookies or authorization headers.
+	// As browsers reject the "*" origin in that case, the origin of the request is sent back instead.
+	AllowCredentials bool
+
+	// MaxAge is the duration for which the result of a preflight request can be cached.
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware that handles cross-origin requests according to the options.
+// Preflight requests are answered directly with a 204 No Content, or a 403 Forbidden if
+// the origin is not allowed, so that they never reach the routes nor the CSRF protection.
+// Because the router answers OPTIONS requests on its own, the middleware should be
+// registered for all routes using Use rather than on specific routes.
+//
+// Cross-origin requests are meant for apis, which should not use the DynChain, as the CSRF
+// protection rejects unsafe requests coming from other origins.
+func (core *Core) CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		}
+	}
+
+	allowedMethods := make(map[string]bool)
+	for _, method := range methods {
+		allowedMethods[strings.ToUpper(method)] = true
+	}
+
+	allowedHeaders := make(map[string]bool)
+	for _, header := range opts.AllowedHeaders {
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// the response depends on the origin, even for same-origin requests
+			w.Header().Add("Vary", "Origin")
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, wildcard := corsOrigin(opts.AllowedOrigins, origin)
+
+			// only preflights are rejected, others are left to the browser
+			if !allowed {
+				if preflight {
+					core.Views.ClientError(w, http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if wildcard && !opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(opts.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+			if !allowedMethods[method] {
+				core.Views.ClientError(w, http.StatusForbidden)
+				return
+			}
+
+			var headers []string
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+				if header == "" {
+					continue
+				}
+				if !allowedHeaders["*"] && !allowedHeaders[header] {
+					core.Views.ClientError(w, http.StatusForbidden)
+					return
+				}
+				headers = append(headers, header)
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", method)
+			if len(headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// corsOrigin reports whether the origin matches one of the allowed origins,
+// and whether it is only because all origins are allowed.
+func corsOrigin(allowedOrigins []string, origin string) (allowed, wildcard bool) {
+	for _, allowedOrigin := range allowedOrigins {
+		switch {
+		case allowedOrigin == "*":
+			wildcard = true
+		case strings.EqualFold(allowedOrigin, origin):
+			return true, false
+		case strings.Contains(allowedOrigin, "*"):
+			prefix, suffix, _ := strings.Cut(allowedOrigin, "*")
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true, false
+			}
+		}
+	}
+
+	return wildcard, wildcard
+}
@@ -0,0 +1,57 @@
+package bow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCORS(t *testing.T) {
+	core, err := NewCore(fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	handler := core.CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		method  string
+		origin  string
+		reqHdrs string
+		status  int
+		allowed bool
+	}{
+		{http.MethodGet, "https://app.example.com", "", http.StatusTeapot, true},
+		{http.MethodGet, "https://evil.com", "", http.StatusTeapot, false},
+		{http.MethodOptions, "https://app.example.com", "content-type", http.StatusNoContent, true},
+		{http.MethodOptions, "https://app.example.com", "X-Secret", http.StatusForbidden, true},
+		{http.MethodOptions, "https://evil.com", "", http.StatusForbidden, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.Header.Set("Origin", tt.origin)
+		if tt.method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			r.Header.Set("Access-Control-Request-Headers", tt.reqHdrs)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s from %s: got status %d, want %d", tt.method, tt.origin, w.Code, tt.status)
+		}
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); (got == tt.origin) != tt.allowed {
+			t.Errorf("%s from %s: got allowed origin %q", tt.method, tt.origin, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package bow
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// unsafeFilenameChars matches characters that should not be part of a downloaded filename.
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// RenderCSV writes rows as a csv file attachment with the given filename.
+// If a translator is configured, header cells from the first row are translated
+// according to the locale of the request. Dates can be formatted beforehand using Format.
+func (core *Core) RenderCSV(w http.ResponseWriter, r *http.Request, filename string, rows [][]string) {
+	if len(rows) > 0 && core.translator != nil {
+		locale := core.reqLocale(r)
+
+		header := make([]string, len(rows[0]))
+		for i, cell := range rows[0] {
+			header[i] = core.translator.Translate(cell, locale)
+		}
+
+		rows = append([][]string{header}, rows[1:]...)
+	}
+
+	// write into a buffer first, so that an error can still result in a 500
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(rows); err != nil {
+		core.Views.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sanitizeFilename(filename)))
+
+	if _, err := buf.WriteTo(w); err != nil {
+		core.Views.Logger.Printf("cannot write csv: %v", err)
+	}
+}
+
+// sanitizeFilename returns a filename that is safe to be used in a Content-Disposition header.
+// It makes sure the csv extension is present.
+func sanitizeFilename(filename string) string {
+	filename = strings.Trim(unsafeFilenameChars.ReplaceAllString(filename, "_"), "._")
+	if filename == "" {
+		filename = "export"
+	}
+
+	if !strings.HasSuffix(filename, ".csv") {
+		filename += ".csv"
+	}
+
+	return filename
+}
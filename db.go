@@ -2,18 +2,41 @@ package bow
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// memoryDBs counts the in-memory databases opened by the process.
+var memoryDBs uint64
+
 // DB represents the database connection.
 type DB struct {
+	// Force allows migrating even if already applied migration files have been
+	// modified. Their checksums are then updated without running them again.
+	Force bool
+
+	// MigrationsDir is the folder of the filesystem containing migration files.
+	// It defaults to "migrations". Migrations are tracked by their path, so changing
+	// the folder of an existing database will make its migrations run again.
+	MigrationsDir string
+
+	// SplitStatements executes the statements of migration files one by one within
+	// their transaction, instead of the whole file at once, so that an error
+	// identifies the failing statement.
+	SplitStatements bool
+
 	db   *sql.DB
 	dsn  string // data source name
 	fsys fs.FS  // filesystem for migration files
@@ -23,30 +46,63 @@ type DB struct {
 // and a filesystem for migration files.
 func NewDB(dns string, fsys fs.FS) *DB {
 	return &DB{
+		MigrationsDir: "migrations",
+
 		dsn:  dns,
 		fsys: fsys,
 	}
 }
 
-// open opens a sqlite database specified by the data source name.
+// Open opens a sqlite database specified by the data source name.
 // It also enables WAL mode and foreign keys check, and finally execute
 // pending SQL migrations.
-func (db *DB) Open() (err error) {
+func (db *DB) Open() error {
+	if err := db.Connect(); err != nil {
+		return err
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	return nil
+}
+
+// Connect opens a sqlite database specified by the data source name
+// and enables WAL mode and foreign keys check, but contrary to Open,
+// it does not execute migrations.
+func (db *DB) Connect() (err error) {
 	if db.dsn == "" {
 		return fmt.Errorf("dsn required")
 	}
 
-	// Create parent directory
-	if db.dsn != ":memory:" {
-		if err := os.MkdirAll(filepath.Dir(db.dsn), 0700); err != nil {
+	dsn := db.dsn
+
+	if dsn == ":memory:" {
+		// A plain :memory: dsn gives a separate database to each connection of the pool,
+		// so a named shared cache is used instead. The name is unique to keep different
+		// in-memory databases of the process isolated.
+		dsn = fmt.Sprintf("file:bow-memory-%d?mode=memory&cache=shared", atomic.AddUint64(&memoryDBs, 1))
+	} else {
+		// Create parent directory
+		if err := os.MkdirAll(filepath.Dir(dsn), 0700); err != nil {
 			return err
 		}
 	}
 
-	if db.db, err = sql.Open("sqlite3", db.dsn); err != nil {
+	if db.db, err = sql.Open("sqlite3", dsn); err != nil {
 		return err
 	}
 
+	if db.dsn == ":memory:" {
+		// The shared in-memory database is removed when its last connection is closed,
+		// and concurrent connections to a shared cache fail with SQLITE_LOCKED instead of
+		// waiting for the busy timeout. So the pool is pinned to a single connection, which
+		// is kept open. Queries are then serialized, which is fine for tests and prototypes.
+		db.db.SetMaxOpenConns(1)
+		db.db.SetMaxIdleConns(1)
+	}
+
 	// Enable WAL. Performs better because multiple readers can operate
 	// while data is being written.
 	if _, err := db.db.Exec(`PRAGMA journal_mode = wal;`); err != nil {
@@ -72,66 +128,340 @@ func (db *DB) Open() (err error) {
 		return fmt.Errorf("set busy timeout: %w", err)
 	}
 
-	if err := db.migrate(); err != nil {
-		return fmt.Errorf("migrate: %w", err)
+	return nil
+}
+
+// Migrate executes pending migration files and returns
+// the names of the ones that have been applied.
+func (db *DB) Migrate() ([]string, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	names, err := db.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, name := range names {
+		ok, err := db.migrateFile(name)
+		if err != nil {
+			return applied, fmt.Errorf("migration error: name=%q err=%w", name, err)
+		}
+		if ok {
+			applied = append(applied, name)
+		}
+	}
+
+	return applied, nil
+}
+
+// MigrationStatus returns the names of the migration files that have
+// already been applied, and the ones that are pending. The database is
+// not modified, so all migrations are pending if it has never been migrated.
+func (db *DB) MigrationStatus() (applied []string, pending []string, err error) {
+	names, err := db.migrationFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tables int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'migrations'`).Scan(&tables); err != nil {
+		return nil, nil, err
+	} else if tables == 0 {
+		return nil, names, nil
+	}
+
+	for _, name := range names {
+		var n int
+		if err := db.db.QueryRow(`SELECT COUNT(*) FROM migrations WHERE name = ?`, name).Scan(&n); err != nil {
+			return nil, nil, err
+		}
+
+		if n != 0 {
+			applied = append(applied, name)
+		} else {
+			pending = append(pending, name)
+		}
+	}
+
+	return applied, pending, nil
 }
 
-// migrate executes pending migration files.
-func (db *DB) migrate() error {
-	// Ensure migration table exists.
-	if _, err := db.db.Exec(`CREATE TABLE IF NOT EXISTS migrations (name TEXT PRIMARY KEY);`); err != nil {
+// ensureMigrationsTable creates the table tracking migrations if it does not exist.
+func (db *DB) ensureMigrationsTable() error {
+	if _, err := db.db.Exec(`CREATE TABLE IF NOT EXISTS migrations (name TEXT PRIMARY KEY, checksum TEXT);`); err != nil {
 		return fmt.Errorf("cannot create migrations table: %w", err)
 	}
 
-	names, err := fs.Glob(db.fsys, "migrations/*.sql")
+	// Add the checksum column to tables created before checksums were introduced.
+	var n int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('migrations') WHERE name = 'checksum'`).Scan(&n); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := db.db.Exec(`ALTER TABLE migrations ADD COLUMN checksum TEXT;`); err != nil {
+			return fmt.Errorf("cannot add checksum to migrations table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migrationFiles returns the sorted names of the migration files.
+func (db *DB) migrationFiles() ([]string, error) {
+	names, err := fs.Glob(db.fsys, path.Join(db.MigrationsDir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// migrateFile runs a single migration file within a transaction.
+// It returns false if the migration had already been run. In that case,
+// it verifies that the file has not been modified since it was applied.
+func (db *DB) migrateFile(name string) (bool, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	buf, err := fs.ReadFile(db.fsys, name)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(buf)
+	checksum := hex.EncodeToString(sum[:])
+
+	// Ensure migration has not already been run.
+	var applied sql.NullString
+	err = tx.QueryRow(`SELECT checksum FROM migrations WHERE name = ?`, name).Scan(&applied)
+	switch {
+	case err == sql.ErrNoRows:
+		// not run yet
+	case err != nil:
+		return false, err
+	case applied.Valid && applied.String != checksum && !db.Force:
+		return false, fmt.Errorf("file has been modified after being applied")
+	case applied.Valid && applied.String == checksum:
+		return false, nil // already run migration, skip
+	default:
+		// Store the checksum of migrations applied before checksums were
+		// introduced, or of modified ones when forced.
+		if _, err := tx.Exec(`UPDATE migrations SET checksum = ? WHERE name = ?`, checksum, name); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	// Execute migration file.
+	if db.SplitStatements {
+		for i, stmt := range splitStatements(string(buf)) {
+			if _, err := tx.Exec(stmt); err != nil {
+				return false, fmt.Errorf("statement %d %q: %w", i+1, stmt, err)
+			}
+		}
+	} else if _, err := tx.Exec(string(buf)); err != nil {
+		return false, err
+	}
+
+	// Insert record into migrations to prevent re-running migration.
+	if _, err := tx.Exec(`INSERT INTO migrations (name, checksum) VALUES (?, ?)`, name, checksum); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// splitStatements splits a sql script into statements on semicolons. Semicolons in
+// quoted strings and identifiers, in comments, and in the body of triggers are skipped.
+// Empty statements are removed.
+func splitStatements(script string) []string {
+	var (
+		stmts   []string
+		start   int
+		trigger bool // the statement creates a trigger
+		depth   int  // of BEGIN and CASE blocks in triggers
+	)
+
+	isWord := func(c byte) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// skip to the closing quote, doubled quotes being escaped ones
+			for i++; i < len(script) && script[i] != c; i++ {
+			}
+		case c == '[':
+			for i++; i < len(script) && script[i] != ']'; i++ {
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i++; i < len(script) && script[i] != '\n'; i++ {
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case isWord(c):
+			j := i
+			for j < len(script) && isWord(script[j]) {
+				j++
+			}
+
+			switch strings.ToUpper(script[i:j]) {
+			case "TRIGGER":
+				trigger = true
+			case "BEGIN", "CASE":
+				if trigger {
+					depth++
+				}
+			case "END":
+				if trigger {
+					depth--
+				}
+			}
+
+			i = j - 1
+		case c == ';' && depth <= 0:
+			if stmt := strings.TrimSpace(script[start : i+1]); stmt != ";" {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+			trigger = false
+			depth = 0
+		}
+	}
+
+	if stmt := strings.TrimSpace(script[start:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
+
+// Seed executes the pending seed files from the seeds folder. Contrary to
+// migrations that define the schema, seeds are meant to load reference data.
+// Each seed file is run only once, and is tracked in the seeds table.
+func (db *DB) Seed() error {
+	if _, err := db.db.Exec(`CREATE TABLE IF NOT EXISTS seeds (name TEXT PRIMARY KEY);`); err != nil {
+		return fmt.Errorf("cannot create seeds table: %w", err)
+	}
+
+	names, err := fs.Glob(db.fsys, "seeds/*.sql")
 	if err != nil {
 		return err
 	}
 	sort.Strings(names)
 
 	for _, name := range names {
-		if err := db.migrateFile(name); err != nil {
-			return fmt.Errorf("migration error: name=%q err=%w", name, err)
+		if err := db.seedFile(name); err != nil {
+			return fmt.Errorf("seed error: name=%q err=%w", name, err)
 		}
 	}
 
 	return nil
 }
 
-// migrateFile runs a single migration file within a transaction.
-func (db *DB) migrateFile(name string) error {
+// seedFile runs a single seed file within a transaction.
+func (db *DB) seedFile(name string) error {
 	tx, err := db.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Ensure migration has not already been run.
+	// Ensure seed has not already been run.
 	var n int
-	if err := tx.QueryRow(`SELECT COUNT(*) FROM migrations WHERE name = ?`, name).Scan(&n); err != nil {
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM seeds WHERE name = ?`, name).Scan(&n); err != nil {
 		return err
 	} else if n != 0 {
-		return nil // already run migration, skip
+		return nil // already run seed, skip
 	}
 
-	// Read and execute migration file.
+	// Read and execute seed file.
 	if buf, err := fs.ReadFile(db.fsys, name); err != nil {
 		return err
 	} else if _, err := tx.Exec(string(buf)); err != nil {
 		return err
 	}
 
-	// Insert record into migrations to prevent re-running migration.
-	if _, err := tx.Exec(`INSERT INTO migrations (name) VALUES (?)`, name); err != nil {
+	// Insert record into seeds to prevent re-running seed.
+	if _, err := tx.Exec(`INSERT INTO seeds (name) VALUES (?)`, name); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
+// InstallTimestampTriggers creates triggers on the given table to automatically
+// set the created_at column on insert when not provided, and the updated_at column on update.
+// The columns must already exist in the table, and the table must have a rowid.
+// It is idempotent, so it can safely be called at each start of the application.
+func (db *DB) InstallTimestampTriggers(table string) error {
+	quoted := quoteIdent(table)
+
+	triggers := []string{
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s AFTER INSERT ON %s FOR EACH ROW
+			WHEN NEW.created_at IS NULL
+			BEGIN
+				UPDATE %s SET created_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+			END;`, quoteIdent(table+"_created_at"), quoted, quoted),
+
+		// the WHEN clause keeps explicitly set values and prevents recursion
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE ON %s FOR EACH ROW
+			WHEN NEW.updated_at IS OLD.updated_at
+			BEGIN
+				UPDATE %s SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
+			END;`, quoteIdent(table+"_updated_at"), quoted, quoted),
+	}
+
+	for _, trigger := range triggers {
+		if _, err := db.db.Exec(trigger); err != nil {
+			return fmt.Errorf("install timestamp triggers on %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// quoteIdent quotes an SQL identifier such as a table name.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Backup writes a consistent snapshot of the database to destPath using VACUUM INTO,
+// which is safe while the application keeps using the database in WAL mode.
+// The destination folder is created if needed, and the snapshot is first written
+// to a temporary file that then replaces destPath, so that it is never left partial.
+func (db *DB) Backup(ctx context.Context, destPath string) error {
+	dir := filepath.Dir(destPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// VACUUM INTO accepts an existing file as long as it is empty
+	tmp, err := os.CreateTemp(dir, filepath.Base(destPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := db.db.ExecContext(ctx, `VACUUM INTO ?`, tmp.Name()); err != nil {
+		return fmt.Errorf("cannot backup: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), destPath)
+}
+
 // Close closes the database connection.
 func (db *DB) Close() error {
 	return db.db.Close()
@@ -141,3 +471,96 @@ func (db *DB) Close() error {
 func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
 	return db.db.BeginTx(ctx, opts)
 }
+
+// WithTx runs fn inside a transaction. The transaction is committed if fn
+// returns nil, and rolled back if it returns an error or panics.
+func (db *DB) WithTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	return db.withTx(ctx, nil, fn)
+}
+
+// WithReadTx runs fn inside a read-only transaction, in the same way as WithTx.
+// SQLite treats read-only as a hint, but such a deferred transaction only acquires a read lock,
+// so in WAL mode it does not block and is not blocked by writers. If a writer is checkpointing,
+// the busy timeout applies as for any other transaction.
+func (db *DB) WithReadTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	return db.withTx(ctx, &sql.TxOptions{ReadOnly: true}, fn)
+}
+
+func (db *DB) withTx(ctx context.Context, opts *sql.TxOptions, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NullString returns a sql.NullString that is valid when s is not empty,
+// so that empty strings are stored as NULL.
+func NullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// StringOrEmpty returns the string of ns, or an empty string if it is NULL.
+func StringOrEmpty(ns sql.NullString) string {
+	if !ns.Valid {
+		return ""
+	}
+	return ns.String
+}
+
+// NullInt64 returns a sql.NullInt64 that is valid when i is not zero,
+// so that zero values are stored as NULL.
+func NullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+// Int64OrZero returns the integer of ni, or zero if it is NULL.
+func Int64OrZero(ni sql.NullInt64) int64 {
+	if !ni.Valid {
+		return 0
+	}
+	return ni.Int64
+}
+
+// NullTime returns a sql.NullTime that is valid when t is not the zero time,
+// so that zero times are stored as NULL.
+func NullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// TimeOrZero returns the time of nt, or the zero time if it is NULL.
+func TimeOrZero(nt sql.NullTime) time.Time {
+	if !nt.Valid {
+		return time.Time{}
+	}
+	return nt.Time
+}
+
+// NullBool returns a sql.NullBool that is valid when b is not nil,
+// as false is a meaningful value for booleans.
+func NullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
+// BoolOrFalse returns the boolean of nb, or false if it is NULL.
+func BoolOrFalse(nb sql.NullBool) bool {
+	return nb.Valid && nb.Bool
+}
@@ -0,0 +1,271 @@
+package bow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrateChecksum(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	fs := fstest.MapFS{
+		"migrations/00000000.sql": {
+			Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"),
+		},
+	}
+
+	db := NewDB(dsn, fs)
+	if err := db.Open(); err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	db.Close()
+
+	fs["migrations/00000000.sql"].Data = []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")
+
+	db = NewDB(dsn, fs)
+	if err := db.Open(); err == nil {
+		t.Fatal("expected an error for a modified migration")
+	}
+	db.Close()
+
+	db = NewDB(dsn, fs)
+	db.Force = true
+	if err := db.Open(); err != nil {
+		t.Fatalf("cannot open db with force: %v", err)
+	}
+	db.Close()
+}
+
+func TestWithTxRollback(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	fs := fstest.MapFS{
+		"migrations/00000000.sql": {
+			Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"),
+		},
+	}
+
+	db := NewDB(dsn, fs)
+	if err := db.Open(); err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+
+	errFail := errors.New("fail")
+
+	err := db.WithTx(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO users (id) VALUES (1);"); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected the error of fn, got: %v", err)
+	}
+
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM users;").Scan(&count); err != nil {
+		t.Fatalf("cannot count users: %v", err)
+	}
+
+	if count != 0 {
+		t.Fatalf("expected the insert to be rolled back, got %d users", count)
+	}
+}
+
+func TestMigrationStatusReadOnly(t *testing.T) {
+	fs := fstest.MapFS{
+		"migrations/00000000.sql": {
+			Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"),
+		},
+	}
+
+	db := NewDB(filepath.Join(t.TempDir(), "test.db"), fs)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	defer db.Close()
+
+	applied, pending, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("cannot get migration status: %v", err)
+	}
+
+	if len(applied) != 0 || len(pending) != 1 {
+		t.Fatalf("expected 1 pending migration, got applied %v and pending %v", applied, pending)
+	}
+
+	var n int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'`).Scan(&n); err != nil {
+		t.Fatalf("cannot query tables: %v", err)
+	} else if n != 0 {
+		t.Fatal("expected the migrations table not to be created")
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("cannot migrate: %v", err)
+	}
+
+	applied, pending, err = db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("cannot get migration status: %v", err)
+	}
+
+	if len(applied) != 1 || len(pending) != 0 {
+		t.Fatalf("expected 1 applied migration, got applied %v and pending %v", applied, pending)
+	}
+}
+
+func TestMemoryConcurrent(t *testing.T) {
+	db := NewDB(":memory:", fstest.MapFS{})
+	if err := db.Open(); err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if _, err := db.db.ExecContext(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY);"); err != nil {
+		t.Fatalf("cannot create table: %v", err)
+	}
+
+	const n = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+
+	for i := 1; i <= n; i++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			if _, err := db.db.ExecContext(ctx, "INSERT INTO users (id) VALUES (?);", id); err != nil {
+				errs <- fmt.Errorf("cannot write: %w", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			var count int
+			if err := db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users;").Scan(&count); err != nil {
+				errs <- fmt.Errorf("cannot read: %w", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users;").Scan(&count); err != nil {
+		t.Fatalf("cannot read: %v", err)
+	}
+
+	if count != n {
+		t.Fatalf("expected %d users, got %d", n, count)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+		-- create users; with a comment
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'a;b');
+
+		/* a trigger; with a block comment */
+		CREATE TRIGGER users_name AFTER INSERT ON users BEGIN
+			UPDATE users SET name = CASE WHEN NEW.name = '' THEN 'it''s; empty' ELSE NEW.name END WHERE id = NEW.id;
+		END;;
+		INSERT INTO users (name) VALUES ("x;y")`
+
+	stmts := splitStatements(script)
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %q", len(stmts), stmts)
+	}
+
+	if !strings.HasPrefix(stmts[1], "/* a trigger") || !strings.HasSuffix(stmts[1], "END;") {
+		t.Fatalf("expected the whole trigger, got %q", stmts[1])
+	}
+
+	if stmts[2] != `INSERT INTO users (name) VALUES ("x;y")` {
+		t.Fatalf("got %q for the last statement", stmts[2])
+	}
+}
+
+func TestMigrateSplitStatementsError(t *testing.T) {
+	fs := fstest.MapFS{
+		"migrations/00000000.sql": {
+			Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);\nINSERT INTO unknown VALUES (1);"),
+		},
+	}
+
+	db := NewDB(":memory:", fs)
+	db.SplitStatements = true
+
+	err := db.Open()
+	if err == nil {
+		t.Fatal("expected an error for the failing statement")
+	}
+	defer db.Close()
+
+	if !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("expected the failing statement in the error, got: %v", err)
+	}
+
+	var n int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'users';").Scan(&n); err != nil {
+		t.Fatalf("cannot query schema: %v", err)
+	}
+
+	if n != 0 {
+		t.Fatal("expected the migration to be rolled back entirely")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+
+	fs := fstest.MapFS{
+		"migrations/00000000.sql": {
+			Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY); INSERT INTO users (id) VALUES (1);"),
+		},
+	}
+
+	db := NewDB(filepath.Join(dir, "test.db"), fs)
+	if err := db.Open(); err != nil {
+		t.Fatalf("cannot open db: %v", err)
+	}
+	defer db.Close()
+
+	dest := filepath.Join(dir, "backups", "test.db")
+
+	// backing up twice checks that an existing backup is replaced
+	for i := 0; i < 2; i++ {
+		if err := db.Backup(context.Background(), dest); err != nil {
+			t.Fatalf("cannot backup: %v", err)
+		}
+	}
+
+	backup := NewDB(dest, fs)
+	if err := backup.Open(); err != nil {
+		t.Fatalf("cannot open backup: %v", err)
+	}
+	defer backup.Close()
+
+	var count int
+	if err := backup.db.QueryRow("SELECT COUNT(*) FROM users;").Scan(&count); err != nil {
+		t.Fatalf("cannot count users: %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("expected 1 user in the backup, got %d", count)
+	}
+}
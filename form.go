@@ -1,14 +1,20 @@
 package bow
 
 import (
+	"errors"
 	"fmt"
+	"mime/multipart"
+	"net/http"
 	"net/mail"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // Form validates form data against a particular set of rules.
@@ -17,14 +23,71 @@ import (
 type Form struct {
 	url.Values
 	errors map[string][]string
+	files  map[string][]*multipart.FileHeader
 }
 
+// maxMultipartMemory is the maximum number of bytes of a multipart
+// form that are stored in memory. The rest is stored in temporary files.
+const maxMultipartMemory = 32 << 20
+
 // New creates a new Form taking data as entry.
 func NewForm(data url.Values) *Form {
 	return &Form{
 		data,
 		map[string][]string{},
+		map[string][]*multipart.FileHeader{},
+	}
+}
+
+// NewMultipartForm parses the multipart form of the request and creates
+// a new Form from it. Compared to NewForm, the Form will also hold uploaded files
+// so that they can be validated.
+func NewMultipartForm(r *http.Request) (*Form, error) {
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		return nil, err
+	}
+
+	form := NewForm(r.PostForm)
+	if r.MultipartForm != nil {
+		form.files = r.MultipartForm.File
 	}
+
+	return form, nil
+}
+
+// ErrFormTooLarge is returned by ParseForm when the body of the request
+// exceeds the maximum number of bytes allowed.
+var ErrFormTooLarge = errors.New("form: request body too large")
+
+// ParseForm limits the body of the request to maxBytes, parses it either as
+// a multipart or as an urlencoded form depending on its content type, and creates
+// a new Form from it. If the body is too large, ErrFormTooLarge is returned,
+// in which case a 413 status should typically be sent back.
+func ParseForm(r *http.Request, maxBytes int64) (*Form, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBytes)
+
+	var err error
+	isMultipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+	if isMultipart {
+		err = r.ParseMultipartForm(maxMultipartMemory)
+	} else {
+		err = r.ParseForm()
+	}
+
+	if err != nil {
+		// http.MaxBytesError only exists as of Go 1.19
+		if strings.Contains(err.Error(), "request body too large") {
+			return nil, ErrFormTooLarge
+		}
+		return nil, err
+	}
+
+	form := NewForm(r.PostForm)
+	if isMultipart && r.MultipartForm != nil {
+		form.files = r.MultipartForm.File
+	}
+
+	return form, nil
 }
 
 // Error retrieves the first error message for a given
@@ -37,6 +100,89 @@ func (f *Form) Error(field string) string {
 	return errors[0]
 }
 
+// ValuesOf returns all the non-blank values submitted for a specific field, such as
+// the options of a select multiple or a group of checkboxes sharing a name, whereas
+// Get only returns the first one. It cannot be named Values as the form embeds url.Values.
+func (f *Form) ValuesOf(field string) []string {
+	var values []string
+	for _, value := range f.Values[field] {
+		if strings.TrimSpace(value) != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Int returns the value of a specific field parsed as an integer. The ok flag is false
+// if the field is absent or not a valid integer. No error is recorded, so it should be
+// combined with IsInteger to report invalid values.
+func (f *Form) Int(field string) (int, bool) {
+	i, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// Float returns the value of a specific field parsed as a float. The ok flag is false
+// if the field is absent or not a valid float. No error is recorded.
+func (f *Form) Float(field string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(f.Get(field)), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// Bool returns the value of a specific field parsed as a boolean. Checked checkboxes
+// send "on", so it is accepted along with the values of strconv.ParseBool such as "true"
+// or "1". The ok flag is false if the field is absent or not a valid boolean, which is the
+// case of unchecked checkboxes. No error is recorded.
+func (f *Form) Bool(field string) (bool, bool) {
+	return parseBool(f.Get(field))
+}
+
+// parseBool parses a submitted boolean value, ignoring case and surrounding spaces.
+// It accepts "on" and "off" along with the values of strconv.ParseBool.
+func parseBool(value string) (bool, bool) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	default:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, false
+		}
+		return b, true
+	}
+}
+
+// NormalizeEmail lowercases and trims the values of specific fields in place,
+// so that later validation and persistence see canonical email addresses.
+func (f *Form) NormalizeEmail(fields ...string) {
+	f.normalize(fields, func(value string) string {
+		return strings.ToLower(strings.TrimSpace(value))
+	})
+}
+
+// NormalizeUnicode applies the unicode NFC normalization to the values of specific
+// fields in place, so that the same text typed with composed or decomposed
+// characters is stored the same way.
+func (f *Form) NormalizeUnicode(fields ...string) {
+	f.normalize(fields, norm.NFC.String)
+}
+
+// normalize rewrites all the values of the given fields using fn.
+func (f *Form) normalize(fields []string, fn func(string) string) {
+	for _, field := range fields {
+		for i, value := range f.Values[field] {
+			f.Values[field][i] = fn(value)
+		}
+	}
+}
+
 // Required checks that specific fields in the form
 // data are present and not blank. If any fields fail this check,
 // add the appropriate message to the form errors.
@@ -49,6 +195,34 @@ func (f *Form) Required(fields ...string) {
 	}
 }
 
+// OneOfRequired checks that at least one of the specific fields in the form
+// data is present and not blank. If none of them are, add the appropriate
+// message to the form errors of each of the fields.
+func (f *Form) OneOfRequired(fields ...string) {
+	for _, field := range fields {
+		if strings.TrimSpace(f.Get(field)) != "" {
+			return
+		}
+	}
+
+	for _, field := range fields {
+		f.CustomError(field, "At least one of these fields is required")
+	}
+}
+
+// RequiredIf checks that a specific field in the form data is present and
+// not blank, but only when the field dependsOn has the value equals.
+// If dependsOn is not present in the form, the check is skipped.
+func (f *Form) RequiredIf(field, dependsOn, equals string) {
+	if _, ok := f.Values[dependsOn]; !ok {
+		return
+	}
+
+	if f.Get(dependsOn) == equals {
+		f.Required(field)
+	}
+}
+
 // MinLength checks that a specific field in the form contains
 // a minimum number of characters. If the check fails, then add
 // the appropriate message to the form errors.
@@ -76,6 +250,29 @@ func (f *Form) MaxLength(field string, d int) {
 	}
 }
 
+// MinSelected checks that a specific field with multiple values, such as a select multiple,
+// has a minimum number of selected values. As for MinLength, a field without values is
+// skipped, so it should be combined with Required. If the check fails, then add
+// the appropriate message to the form errors.
+func (f *Form) MinSelected(field string, n int) {
+	count := len(f.ValuesOf(field))
+	if count == 0 {
+		return
+	}
+	if count < n {
+		f.CustomError(field, fmt.Sprintf("Too few options are selected (minimum is %d)", n))
+	}
+}
+
+// MaxSelected checks that a specific field with multiple values, such as a select multiple,
+// has a maximum number of selected values. If the check fails, then add
+// the appropriate message to the form errors.
+func (f *Form) MaxSelected(field string, n int) {
+	if len(f.ValuesOf(field)) > n {
+		f.CustomError(field, fmt.Sprintf("Too many options are selected (maximum is %d)", n))
+	}
+}
+
 // PermittedValues checks that a specific field in the form matches
 // one of a set of specific permitted values. If the check fails,
 // then add the appropriate message to the form errors.
@@ -92,6 +289,23 @@ func (f *Form) PermittedValues(field string, opts ...string) {
 	f.CustomError(field, "This field is invalid")
 }
 
+// PermittedValuesInt checks that a specific field in the form is an integer
+// matching one of a set of specific permitted values. Empty values and values that
+// are not integers are skipped, so that the latter are only reported by IsInteger.
+// If the check fails, then add the appropriate message to the form errors.
+func (f *Form) PermittedValuesInt(field string, opts ...int) {
+	value, ok := f.Int(field)
+	if !ok {
+		return
+	}
+	for _, opt := range opts {
+		if value == opt {
+			return
+		}
+	}
+	f.CustomError(field, "This field is invalid")
+}
+
 // MatchesPattern checks that a specific field in the form matches
 // a regular expression. If the check fails, then add the appropriate
 // message to the form errors.
@@ -157,12 +371,307 @@ func (f *Form) IsInteger(fields ...string) {
 	}
 }
 
+// FileRequired checks that files have been uploaded for specific fields
+// in the form. If any fields fail this check, add the appropriate message to
+// the form errors.
+func (f *Form) FileRequired(fields ...string) {
+	for _, field := range fields {
+		if len(f.files[field]) == 0 {
+			f.CustomError(field, "This field cannot be blank")
+		}
+	}
+}
+
+// MaxFileSize checks that the files uploaded for a specific field in the form
+// don't exceed a maximum number of bytes. If the check fails, then add
+// the appropriate message to the form errors.
+func (f *Form) MaxFileSize(field string, bytes int64) {
+	for _, fh := range f.files[field] {
+		if fh.Size > bytes {
+			f.CustomError(field, fmt.Sprintf("This file is too large (maximum is %d bytes)", bytes))
+			return
+		}
+	}
+}
+
+// PermittedMIME checks that the files uploaded for a specific field in the form
+// match one of a set of permitted MIME types. The type is detected from the content
+// of the file rather than trusting the one sent by the client. If the check fails,
+// then add the appropriate message to the form errors.
+func (f *Form) PermittedMIME(field string, types ...string) {
+	for _, fh := range f.files[field] {
+		mime, err := detectMIME(fh)
+		if err != nil {
+			f.CustomError(field, "This file cannot be read")
+			return
+		}
+
+		if !permittedMIME(mime, types) {
+			f.CustomError(field, "This file type is not permitted")
+			return
+		}
+	}
+}
+
+// detectMIME sniffs the content type of an uploaded file.
+func detectMIME(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// at most 512 bytes are considered by http.DetectContentType
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && n == 0 && fh.Size > 0 {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// permittedMIME returns true if the mime type, stripped from its parameters,
+// is part of the given types.
+func permittedMIME(mime string, types []string) bool {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+	for _, t := range types {
+		if mime == t {
+			return true
+		}
+	}
+	return false
+}
+
+// timeLayouts are the layouts accepted to scan time.Time fields,
+// matching the values sent by date, time and datetime-local inputs.
+var timeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "15:04"}
+
+// Scan populates the struct pointed to by dst from the form values, using the
+// form struct tags to match fields (e.g. `form:"email"`). Fields without tag are ignored.
+// It supports string, int, uint, bool, float and time.Time fields. Empty values leave
+// fields untouched. When a value cannot be converted, an error is recorded in the form
+// for the field, and an error is returned once all fields have been scanned.
+func (f *Form) Scan(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("scan destination should be a pointer to a struct")
+	}
+	v = v.Elem()
+
+	var invalid []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		name := field.Tag.Get("form")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		value := f.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if msg := scanValue(v.Field(i), value); msg != "" {
+			f.CustomError(name, msg)
+			invalid = append(invalid, name)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("cannot scan fields: %s", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
+
+// scanValue converts a form value to the type of the field and sets it.
+// It returns an error message suitable for the form if it fails.
+func scanValue(field reflect.Value, value string) string {
+	if _, ok := field.Interface().(time.Time); ok {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				field.Set(reflect.ValueOf(t))
+				return ""
+			}
+		}
+		return "This field is not a valid date"
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return "This field is not a valid integer"
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return "This field is not a valid integer"
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return "This field is not a valid number"
+		}
+		field.SetFloat(fl)
+	case reflect.Bool:
+		// checkboxes send "on" when checked
+		b, ok := parseBool(value)
+		if !ok {
+			return "This field is invalid"
+		}
+		field.SetBool(b)
+	default:
+		return "This field is invalid"
+	}
+
+	return ""
+}
+
 // CustomError adds a specific error for a field.
 func (f *Form) CustomError(field, msg string) {
 	f.errors[field] = append(f.errors[field], msg)
 }
 
+// Localize translates the recorded error messages into the language of the locale.
+// Messages containing values, such as lengths, can be translated using placeholders
+// like "This field is too short (minimum is % characters)". Without a translator,
+// the messages stay in english.
+func (f *Form) Localize(tr *Translator, locale string) {
+	if tr == nil {
+		return
+	}
+
+	for field, msgs := range f.errors {
+		for i, msg := range msgs {
+			f.errors[field][i] = tr.Translate(msg, locale)
+		}
+	}
+}
+
 // Valid returns true if there are no errors in the form.
 func (f *Form) Valid() bool {
 	return len(f.errors) == 0
 }
+
+// Field allows to chain validation rules on a specific field of a form,
+// such as f.Field("email").Required().MaxLength(255).IsEmail().
+// Errors are recorded on the form as with the corresponding Form methods.
+type Field struct {
+	form *Form
+	name string
+}
+
+// Field returns a validation builder for a specific field of the form.
+func (f *Form) Field(name string) *Field {
+	return &Field{form: f, name: name}
+}
+
+// Required checks that the field is present and not blank.
+func (fd *Field) Required() *Field {
+	fd.form.Required(fd.name)
+	return fd
+}
+
+// RequiredIf checks that the field is present and not blank
+// when the field dependsOn has the value equals.
+func (fd *Field) RequiredIf(dependsOn, equals string) *Field {
+	fd.form.RequiredIf(fd.name, dependsOn, equals)
+	return fd
+}
+
+// MinLength checks that the field contains a minimum number of characters.
+func (fd *Field) MinLength(d int) *Field {
+	fd.form.MinLength(fd.name, d)
+	return fd
+}
+
+// MaxLength checks that the field contains a maximum number of characters.
+func (fd *Field) MaxLength(d int) *Field {
+	fd.form.MaxLength(fd.name, d)
+	return fd
+}
+
+// MinSelected checks that the field has a minimum number of selected values.
+func (fd *Field) MinSelected(n int) *Field {
+	fd.form.MinSelected(fd.name, n)
+	return fd
+}
+
+// MaxSelected checks that the field has a maximum number of selected values.
+func (fd *Field) MaxSelected(n int) *Field {
+	fd.form.MaxSelected(fd.name, n)
+	return fd
+}
+
+// PermittedValues checks that the field matches one of a set of permitted values.
+func (fd *Field) PermittedValues(opts ...string) *Field {
+	fd.form.PermittedValues(fd.name, opts...)
+	return fd
+}
+
+// PermittedValuesInt checks that the field is an integer matching one of a set of permitted values.
+func (fd *Field) PermittedValuesInt(opts ...int) *Field {
+	fd.form.PermittedValuesInt(fd.name, opts...)
+	return fd
+}
+
+// MatchesPattern checks that the field matches a regular expression.
+func (fd *Field) MatchesPattern(pattern *regexp.Regexp) *Field {
+	fd.form.MatchesPattern(fd.name, pattern)
+	return fd
+}
+
+// IsEmail checks that the field is a correct email.
+func (fd *Field) IsEmail() *Field {
+	fd.form.IsEmail(fd.name)
+	return fd
+}
+
+// IsDate checks that the field is a correct date.
+func (fd *Field) IsDate() *Field {
+	fd.form.IsDate(fd.name)
+	return fd
+}
+
+// IsTime checks that the field is a correct time.
+func (fd *Field) IsTime() *Field {
+	fd.form.IsTime(fd.name)
+	return fd
+}
+
+// IsInteger checks that the field is an integer.
+func (fd *Field) IsInteger() *Field {
+	fd.form.IsInteger(fd.name)
+	return fd
+}
+
+// FileRequired checks that files have been uploaded for the field.
+func (fd *Field) FileRequired() *Field {
+	fd.form.FileRequired(fd.name)
+	return fd
+}
+
+// MaxFileSize checks that the files uploaded for the field don't exceed a maximum number of bytes.
+func (fd *Field) MaxFileSize(bytes int64) *Field {
+	fd.form.MaxFileSize(fd.name, bytes)
+	return fd
+}
+
+// PermittedMIME checks that the files uploaded for the field have one of the permitted mime types.
+func (fd *Field) PermittedMIME(types ...string) *Field {
+	fd.form.PermittedMIME(fd.name, types...)
+	return fd
+}
+
+// CustomError adds a specific error message for the field.
+func (fd *Field) CustomError(msg string) *Field {
+	fd.form.CustomError(fd.name, msg)
+	return fd
+}
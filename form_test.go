@@ -0,0 +1,116 @@
+package bow
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormScan(t *testing.T) {
+	var dst struct {
+		Name    string    `form:"name"`
+		Age     int       `form:"age"`
+		Active  bool      `form:"active"`
+		Score   float64   `form:"score"`
+		Born    time.Time `form:"born"`
+		Ignored string
+	}
+
+	form := NewForm(url.Values{
+		"name":    {"John"},
+		"age":     {"42"},
+		"active":  {"on"},
+		"score":   {"9.5"},
+		"born":    {"1980-01-02"},
+		"Ignored": {"value"},
+	})
+
+	if err := form.Scan(&dst); err != nil {
+		t.Fatalf("cannot scan form: %v", err)
+	}
+
+	born := time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC)
+	if dst.Name != "John" || dst.Age != 42 || !dst.Active || dst.Score != 9.5 || !dst.Born.Equal(born) || dst.Ignored != "" {
+		t.Fatalf("unexpected scanned struct: %+v", dst)
+	}
+
+	form = NewForm(url.Values{"age": {"old"}})
+	if err := form.Scan(&dst); err == nil {
+		t.Fatal("expected an error for an invalid integer")
+	}
+
+	if form.Valid() || form.Error("age") == "" {
+		t.Fatal("expected an error to be recorded for the age field")
+	}
+}
+
+func TestFormBoolScanAgree(t *testing.T) {
+	for _, value := range []string{"on", "On", "off", "OFF", "true", "False", "1", "0", " on "} {
+		form := NewForm(url.Values{"active": {value}})
+
+		want, ok := form.Bool("active")
+		if !ok {
+			t.Fatalf("expected %q to be a valid boolean", value)
+		}
+
+		// start from the opposite value, so that scanning has to set it
+		dst := struct {
+			Active bool `form:"active"`
+		}{Active: !want}
+
+		if err := form.Scan(&dst); err != nil {
+			t.Fatalf("cannot scan %q: %v", value, err)
+		}
+
+		if dst.Active != want {
+			t.Fatalf("scanned %q as %v, but Bool returns %v", value, dst.Active, want)
+		}
+	}
+}
+
+func TestParseFormTooLarge(t *testing.T) {
+	body := "name=" + strings.Repeat("a", 100)
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if _, err := ParseForm(r, 10); !errors.Is(err, ErrFormTooLarge) {
+		t.Fatalf("expected ErrFormTooLarge, got: %v", err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	form, err := ParseForm(r, 1024)
+	if err != nil {
+		t.Fatalf("cannot parse form: %v", err)
+	}
+
+	if got := len(form.Get("name")); got != 100 {
+		t.Fatalf("expected a name of 100 chars, got %d", got)
+	}
+}
+
+func TestFormSelected(t *testing.T) {
+	form := NewForm(url.Values{
+		"tags": {"go", "", "web"},
+	})
+
+	if got := form.ValuesOf("tags"); len(got) != 2 || got[0] != "go" || got[1] != "web" {
+		t.Fatalf("got %q, want the non-blank values", got)
+	}
+
+	form.MinSelected("tags", 2)
+	form.MaxSelected("tags", 2)
+	if !form.Valid() {
+		t.Fatalf("expected two tags to be valid, got %q", form.Error("tags"))
+	}
+
+	form.Field("tags").MinSelected(3)
+	if form.Error("tags") == "" {
+		t.Fatal("expected an error for too few tags")
+	}
+}
@@ -0,0 +1,92 @@
+package bow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// dict builds a map from alternating key and value arguments.
+// It allows to pass multiple values to a partial from within a template,
+// such as {{ partial "card" (dict "Title" .Name "Active" true) }}.
+func dict(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, errors.New("dict requires an even number of arguments")
+	}
+
+	m := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", values[i])
+		}
+		m[key] = values[i+1]
+	}
+
+	return m, nil
+}
+
+// title returns a copy of s with the first letter of each word in upper case.
+func title(s string) string {
+	return cases.Title(language.Und, cases.NoLower).String(s)
+}
+
+// truncate shortens s to a length of n characters, ending with an ellipsis
+// if it has been truncated. It does not split multibyte characters.
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
+
+// fallback returns def when value is empty, that is to say nil,
+// a zero value or an empty slice, map or string. It is named "default"
+// in templates and meant to be used in pipelines such as {{ .Name | default "anonymous" }}.
+func fallback(def, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+
+	return value
+}
+
+func add(a, b int) int { return a + b }
+func sub(a, b int) int { return a - b }
+func mul(a, b int) int { return a * b }
+
+// div returns the integer division of a by b,
+// or an error if b is zero so that the rendering fails.
+func div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+// mod returns the remainder of the division of a by b,
+// or an error if b is zero so that the rendering fails.
+func mod(a, b int) (int, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a % b, nil
+}
@@ -4,17 +4,21 @@ go 1.18
 
 require (
 	github.com/benbjohnson/hashfs v0.2.1
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/golangcollege/sessions v1.2.0
 	github.com/goodsign/monday v1.0.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/alice v1.2.0
 	github.com/justinas/nosurf v1.1.1
 	github.com/mattn/go-sqlite3 v1.14.15
 	golang.org/x/mod v0.5.1
+	golang.org/x/text v0.3.7
+	golang.org/x/time v0.5.0
 )
 
 require (
 	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6 // indirect
-	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+	golang.org/x/sys v0.0.0-20220908164124-27713097b956 // indirect
 	golang.org/x/xerrors v0.0.0-20191011141410-1b5146add898 // indirect
 )
@@ -0,0 +1,53 @@
+package bow
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// IdempotencyField is the name of the hidden form field holding the idempotency token.
+const IdempotencyField = "idempotency_token"
+
+// idempotencyToken generates a new token for the form identified by key,
+// stores it in the session and returns the hidden field holding it.
+// It is exposed in templates as the idempotency_token func.
+func (core *Core) idempotencyToken(r *http.Request, key string) (template.HTML, error) {
+	if core.Session == nil {
+		return "", errors.New("idempotency tokens require sessions")
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	core.Session.Put(r, "idempotency:"+key, token)
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, IdempotencyField, token)), nil
+}
+
+// CheckIdempotency verifies the idempotency token submitted with the form identified by key,
+// as generated in the template using {{ idempotency_token "key" }}.
+// A token can only be verified once, so it returns false if the form is submitted again,
+// such as when a user double-clicks on the submit button.
+// Contrary to CSRF protection, it guards against duplicate submissions of a same valid form.
+func (core *Core) CheckIdempotency(r *http.Request, key string) (bool, error) {
+	if core.Session == nil {
+		return false, errors.New("idempotency tokens require sessions")
+	}
+
+	stored, _ := core.Session.Pop(r, "idempotency:"+key).(string)
+	token := r.PostFormValue(IdempotencyField)
+
+	if stored == "" || token == "" {
+		return false, nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(token)) == 1, nil
+}
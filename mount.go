@@ -0,0 +1,65 @@
+package bow
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Mount returns a handler serving handler under the given prefix, such as "/admin".
+// The prefix is stripped from the request path, so that the routes of the mounted handler
+// are defined from its root. The middleware chains of the parent still apply when the
+// returned handler is registered, and the mounted handler can have its own ones.
+//
+// The prefix is kept in the request context, so that links and redirects of the mounted
+// handler can be built with MountPath, or with the "mountpath" template func for asset
+// urls generated with "hash" that would otherwise be relative to the root.
+//
+// A root prefix such as "/" or an empty one mounts nothing, and the handler is returned as is.
+//
+//	router.Handler(http.MethodGet, "/admin/*path", app.Mount("/admin", admin.Routes()))
+func (core *Core) Mount(prefix string, handler http.Handler) http.Handler {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return handler
+	}
+	prefix = "/" + prefix
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			core.Views.ClientError(w, http.StatusNotFound)
+			return
+		}
+
+		parent := MountPrefix(r)
+
+		r2 := r.Clone(context.WithValue(r.Context(), contextKeyMountPrefix, parent+prefix))
+		r2.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		r2.URL.RawPath = ""
+
+		// keep escaped segments such as %2F, as http.StripPrefix does
+		if strings.HasPrefix(r.URL.RawPath, prefix) {
+			r2.URL.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.RawPath, prefix), "/")
+		}
+
+		handler.ServeHTTP(w, r2)
+	})
+}
+
+// MountPrefix returns the prefix under which the current handler has been mounted
+// using Mount, or an empty string if it is not mounted.
+func MountPrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(contextKeyMountPrefix).(string)
+	return prefix
+}
+
+// MountPath returns the given absolute path prefixed with
+// the prefix under which the current handler has been mounted.
+func MountPath(r *http.Request, p string) string {
+	prefix := MountPrefix(r)
+	if prefix == "" {
+		return p
+	}
+	return path.Join(prefix, "/"+p)
+}
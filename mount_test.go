@@ -0,0 +1,52 @@
+package bow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMount(t *testing.T) {
+	core, err := NewCore(fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	var path, rawPath, prefix string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, rawPath, prefix = r.URL.Path, r.URL.RawPath, MountPrefix(r)
+	})
+
+	tests := []struct {
+		mount   string
+		target  string
+		status  int
+		path    string
+		rawPath string
+		prefix  string
+	}{
+		{mount: "/admin", target: "/admin", status: http.StatusOK, path: "/", prefix: "/admin"},
+		{mount: "/admin", target: "/admin/users", status: http.StatusOK, path: "/users", prefix: "/admin"},
+		{mount: "/admin", target: "/admin/files/a%2Fb", status: http.StatusOK, path: "/files/a/b", rawPath: "/files/a%2Fb", prefix: "/admin"},
+		{mount: "/admin", target: "/administrator", status: http.StatusNotFound},
+		{mount: "/", target: "/users", status: http.StatusOK, path: "/users"},
+		{mount: "", target: "/", status: http.StatusOK, path: "/"},
+	}
+
+	for _, tt := range tests {
+		path, rawPath, prefix = "", "", ""
+
+		w := httptest.NewRecorder()
+		core.Mount(tt.mount, handler).ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+
+		if w.Code != tt.status {
+			t.Fatalf("mount %q, %s: got status %d, want %d", tt.mount, tt.target, w.Code, tt.status)
+		}
+
+		if path != tt.path || rawPath != tt.rawPath || prefix != tt.prefix {
+			t.Fatalf("mount %q, %s: got path %q, raw path %q and prefix %q, want %q, %q and %q",
+				tt.mount, tt.target, path, rawPath, prefix, tt.path, tt.rawPath, tt.prefix)
+		}
+	}
+}
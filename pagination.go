@@ -0,0 +1,115 @@
+package bow
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// defaultPerPage is the number of items per page used when none is given.
+const defaultPerPage = 20
+
+// Pagination computes the values needed to display a page of a list,
+// and to query it using LIMIT and OFFSET.
+type Pagination struct {
+	Page    int // current page, starting at 1
+	PerPage int
+	Total   int // number of items
+	Pages   int // number of pages
+
+	query url.Values
+	path  string
+}
+
+// NewPagination creates a pagination for a total number of items, reading the
+// current page from the "page" query parameter of the request. Invalid or out of
+// range pages are clamped to the first or last page.
+func NewPagination(r *http.Request, total, perPage int) *Pagination {
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+
+	if total < 0 {
+		total = 0
+	}
+
+	pages := (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	switch {
+	case err != nil || page < 1:
+		page = 1
+	case page > pages:
+		page = pages
+	}
+
+	return &Pagination{
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+		Pages:   pages,
+
+		query: r.URL.Query(),
+		path:  r.URL.Path,
+	}
+}
+
+// Offset returns the number of items to skip to get to the current page.
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Limit returns the maximum number of items of a page.
+func (p *Pagination) Limit() int {
+	return p.PerPage
+}
+
+// HasPrev returns true if there is a page before the current one.
+func (p *Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext returns true if there is a page after the current one.
+func (p *Pagination) HasNext() bool {
+	return p.Page < p.Pages
+}
+
+// Prev returns the number of the previous page.
+func (p *Pagination) Prev() int {
+	if !p.HasPrev() {
+		return p.Page
+	}
+	return p.Page - 1
+}
+
+// Next returns the number of the next page.
+func (p *Pagination) Next() int {
+	if !p.HasNext() {
+		return p.Page
+	}
+	return p.Page + 1
+}
+
+// PageNumbers returns the numbers of all the pages, to iterate over in templates.
+func (p *Pagination) PageNumbers() []int {
+	numbers := make([]int, p.Pages)
+	for i := range numbers {
+		numbers[i] = i + 1
+	}
+	return numbers
+}
+
+// URL returns the url of the given page, keeping the other query parameters of the
+// request so that filters are preserved, such as {{ .Pagination.URL .Pagination.Next }}.
+func (p *Pagination) URL(page int) string {
+	query := url.Values{}
+	for k, v := range p.query {
+		query[k] = v
+	}
+	query.Set("page", strconv.Itoa(page))
+
+	return p.path + "?" + query.Encode()
+}
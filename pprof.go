@@ -0,0 +1,44 @@
+package bow
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RegisterPprof registers the standard pprof handlers on the router under the given prefix.
+// If prefix is empty, "/debug/pprof" is used. The handlers are only registered when debug
+// is enabled or when explicitly enabled using WithPprof, otherwise it does nothing.
+// The profiles are then available under the prefix (e.g. /debug/pprof/heap).
+func (core *Core) RegisterPprof(router *httprouter.Router, prefix string) {
+	if !core.Views.Debug && !core.pprof {
+		return
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		prefix = "/debug/pprof"
+	}
+
+	router.HandlerFunc(http.MethodGet, prefix+"/", pprof.Index)
+	router.HandlerFunc(http.MethodPost, prefix+"/symbol", pprof.Symbol)
+
+	// httprouter does not allow static segments next to a wildcard one,
+	// so named profiles and special handlers share a single route.
+	router.GET(prefix+"/:name", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		switch name := ps.ByName("name"); name {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Handler(name).ServeHTTP(w, r)
+		}
+	})
+}
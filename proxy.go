@@ -0,0 +1,80 @@
+package bow
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the ip address of the client. The X-Forwarded-For header is only
+// honored when the request comes from a proxy trusted using WithTrustedProxies, as
+// it could otherwise be spoofed. The header is then read from right to left, and
+// the first address that is not a trusted proxy is the one of the client.
+func (core *Core) ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !core.trustedProxy(ip) {
+		return ip
+	}
+
+	fwd := r.Header.Values("X-Forwarded-For")
+	if len(fwd) == 0 {
+		return ip
+	}
+
+	addrs := strings.Split(strings.Join(fwd, ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(addrs[i])
+		if addr == "" {
+			continue
+		}
+
+		ip = addr
+		if !core.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Scheme returns the scheme used by the client, "http" or "https". The X-Forwarded-Proto
+// header is only honored when the request comes from a proxy trusted using WithTrustedProxies.
+func (core *Core) Scheme(r *http.Request) string {
+	if core.trustedProxy(remoteIP(r)) {
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// trustedProxy returns true if the ip address belongs to a trusted proxy network.
+func (core *Core) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range core.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the ip address of the immediate peer of the request.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
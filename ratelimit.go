@@ -0,0 +1,70 @@
+package bow
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// visitor holds the rate limiter of a client along with
+// the last time it has been seen.
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimit returns a middleware that limits the number of requests per second
+// a client can make, identified by its ip address as returned by ClientIP. Bursts of up to burst requests
+// are allowed. When the limit is exceeded, it responds with 429 Too Many Requests
+// and a Retry-After header. Clients that have not been seen for a while are forgotten.
+// It is meant to be applied to sensitive routes such as login or signup using alice.
+func (core *Core) RateLimit(rps float64, burst int) func(http.Handler) http.Handler {
+	var (
+		mu        sync.Mutex
+		visitors  = make(map[string]*visitor)
+		lastSweep = time.Now()
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := core.ClientIP(r)
+
+			mu.Lock()
+
+			// remove clients not seen recently, at most once a minute, so that
+			// no background goroutine outlives the middleware
+			if now := time.Now(); now.Sub(lastSweep) > time.Minute {
+				for ip, v := range visitors {
+					if now.Sub(v.lastSeen) > 3*time.Minute {
+						delete(visitors, ip)
+					}
+				}
+				lastSweep = now
+			}
+
+			v, ok := visitors[ip]
+			if !ok {
+				v = &visitor{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+				visitors[ip] = v
+			}
+			v.lastSeen = time.Now()
+			reservation := v.limiter.Reserve()
+			mu.Unlock()
+
+			if delay := reservation.Delay(); delay > 0 {
+				// the request is rejected so it should not consume a token
+				reservation.Cancel()
+
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				core.Views.ClientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
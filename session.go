@@ -0,0 +1,82 @@
+package bow
+
+import (
+	"net/http"
+
+	"github.com/golangcollege/sessions"
+)
+
+// SessionStore stores data across requests for a user.
+// The default store used by WithSession keeps sessions in encrypted cookies.
+// Values stored in a session should be registered with gob if the store
+// relies on it to encode them.
+type SessionStore interface {
+	// Put adds a value to the session of the request.
+	Put(r *http.Request, key string, val interface{})
+
+	// Get returns a value from the session of the request,
+	// or nil if it does not exist.
+	Get(r *http.Request, key string) interface{}
+
+	// Pop returns a value from the session of the request
+	// and removes it, or returns nil if it does not exist.
+	Pop(r *http.Request, key string) interface{}
+
+	// Remove removes a value from the session of the request.
+	Remove(r *http.Request, key string)
+
+	// Enable is a middleware that loads and saves the session of the request.
+	Enable(next http.Handler) http.Handler
+}
+
+// the cookie sessions are the default store
+var _ SessionStore = (*sessions.Session)(nil)
+
+// SessionGetString returns a string from the session of the request.
+// It returns false if the value does not exist, is not a string,
+// or if sessions are not enabled.
+func (core *Core) SessionGetString(r *http.Request, key string) (string, bool) {
+	if core.Session == nil {
+		return "", false
+	}
+	s, ok := core.Session.Get(r, key).(string)
+	return s, ok
+}
+
+// SessionPutString adds a string to the session of the request.
+// It does nothing if sessions are not enabled.
+func (core *Core) SessionPutString(r *http.Request, key string, val string) {
+	if core.Session == nil {
+		return
+	}
+	core.Session.Put(r, key, val)
+}
+
+// SessionGetInt returns an int from the session of the request.
+// It returns false if the value does not exist, is not an int,
+// or if sessions are not enabled.
+func (core *Core) SessionGetInt(r *http.Request, key string) (int, bool) {
+	if core.Session == nil {
+		return 0, false
+	}
+	i, ok := core.Session.Get(r, key).(int)
+	return i, ok
+}
+
+// SessionPutInt adds an int to the session of the request.
+// It does nothing if sessions are not enabled.
+func (core *Core) SessionPutInt(r *http.Request, key string, val int) {
+	if core.Session == nil {
+		return
+	}
+	core.Session.Put(r, key, val)
+}
+
+// SessionDelete removes a value from the session of the request.
+// It does nothing if sessions are not enabled.
+func (core *Core) SessionDelete(r *http.Request, key string) {
+	if core.Session == nil {
+		return
+	}
+	core.Session.Remove(r, key)
+}
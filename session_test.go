@@ -0,0 +1,97 @@
+package bow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSessionDisabled(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/index.html": {
+			Data: []byte("hello, world"),
+		},
+	}
+
+	core, err := NewCore(fs)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+
+	core.SessionPutInt(r, "user", 1)
+	core.SessionPutString(r, "name", "john")
+
+	if i, ok := core.SessionGetInt(r, "user"); ok || i != 0 {
+		t.Errorf("got %d, %t for int, want zero value without sessions", i, ok)
+	}
+
+	if s, ok := core.SessionGetString(r, "name"); ok || s != "" {
+		t.Errorf("got %q, %t for string, want zero value without sessions", s, ok)
+	}
+
+	core.SessionDelete(r, "user")
+}
+
+// mapStore is a session store shared by all requests.
+type mapStore map[string]interface{}
+
+func (m mapStore) Put(r *http.Request, key string, val interface{}) { m[key] = val }
+func (m mapStore) Get(r *http.Request, key string) interface{}      { return m[key] }
+func (m mapStore) Remove(r *http.Request, key string)               { delete(m, key) }
+func (m mapStore) Enable(next http.Handler) http.Handler            { return next }
+
+func (m mapStore) Pop(r *http.Request, key string) interface{} {
+	val := m[key]
+	delete(m, key)
+	return val
+}
+
+func TestCheckIdempotency(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "content" . }}`),
+		},
+		"views/form.html": {
+			Data: []byte(`{{ define "content" }}{{ idempotency_token "signup" }}{{ end }}`),
+		},
+	}
+
+	core, err := NewCore(fs, WithSessionStore(mapStore{}))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	core.Views.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "form", nil)
+
+	m := regexp.MustCompile(`name="idempotency_token" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("expected a hidden field, got %q", w.Body.String())
+	}
+
+	submit := func() bool {
+		body := url.Values{IdempotencyField: {m[1]}}.Encode()
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		ok, err := core.CheckIdempotency(r, "signup")
+		if err != nil {
+			t.Fatalf("cannot check idempotency: %v", err)
+		}
+		return ok
+	}
+
+	if !submit() {
+		t.Fatal("expected the first submission to be accepted")
+	}
+
+	if submit() {
+		t.Fatal("expected the second submission to be rejected")
+	}
+}
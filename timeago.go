@@ -0,0 +1,50 @@
+package bow
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeUnits are used to humanize durations, from the largest to the smallest.
+var timeUnits = []struct {
+	d    time.Duration
+	name string
+}{
+	{365 * 24 * time.Hour, "year"},
+	{30 * 24 * time.Hour, "month"},
+	{24 * time.Hour, "day"},
+	{time.Hour, "hour"},
+	{time.Minute, "minute"},
+}
+
+// timeAgo returns a human-readable english representation of t relative
+// to now such as "3 minutes ago" or "in 2 days". Less than a minute is "just now".
+// The returned messages can be translated using placeholders like "% minutes ago".
+func timeAgo(t, now time.Time) string {
+	d := now.Sub(t)
+
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	for _, unit := range timeUnits {
+		if d < unit.d {
+			continue
+		}
+
+		n := int(d / unit.d)
+
+		name := unit.name
+		if n > 1 {
+			name += "s"
+		}
+
+		if future {
+			return fmt.Sprintf("in %d %s", n, name)
+		}
+		return fmt.Sprintf("%d %s ago", n, name)
+	}
+
+	return "just now"
+}
@@ -0,0 +1,114 @@
+package bow
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout returns a middleware that bounds the time a handler can take.
+// The handler receives a request context with a deadline, so that database
+// queries or outgoing requests using it are cancelled. If the handler has not
+// finished when the deadline is reached, a 503 Service Unavailable is sent and
+// the connection is closed. Whatever the handler writes after that is discarded.
+//
+// As for http.TimeoutHandler, the response is buffered until the handler returns,
+// so it should not be applied to streaming handlers.
+func (core *Core) Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panicked <- err
+					}
+				}()
+
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case err := <-panicked:
+				// propagate to the recoverPanic middleware
+				panic(err)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+
+				// make the http.Server automatically close the current connection.
+				w.Header().Set("Connection", "close")
+				core.Views.ClientError(w, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler
+// so that it can be dropped if the handler times out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+
+	tw.status = status
+}
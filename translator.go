@@ -2,16 +2,17 @@ package bow
 
 import (
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/goodsign/monday"
@@ -24,46 +25,125 @@ const (
 
 type index map[string]string
 
+// pattern is a compiled translation with placeholders.
+type pattern struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+var (
+	// localeRegexp matches a valid locale such as en_US.
+	localeRegexp = regexp.MustCompile("^[a-z]{2}_[A-Z]{2}$")
+
+	// placeholderRegexp matches a placeholder that is not escaped by another placeholder.
+	placeholderRegexp = regexp.MustCompile(fmt.Sprintf("(^|[^%s])%s([^%s]|$)", placeholder, placeholder, placeholder))
+)
+
 // Translator allows to translate a message from english to a predefined
 // set of locales parsed from csv files. Il also deals with date and time formats.
 type Translator struct {
-	locales map[string]bool
-	dict    map[string]index
-	regDict map[string]index // used for translations with placeholders
+	// Debug enables recording messages that could not be translated,
+	// so that they can be listed with Missing.
+	Debug bool
+
+	// OnMissing is called when a message could not be translated for a locale.
+	// It is not called for the default locale, as its messages are not translated.
+	OnMissing func(locale, msg string)
+
+	// Dir is the folder of the filesystem containing the translation files.
+	// It defaults to "translations".
+	Dir string
+
+	mu sync.RWMutex
+
+	locales   map[string]bool
+	dict      map[string]index
+	regDict   map[string]index     // used for translations with placeholders
+	patterns  map[string][]pattern // compiled from regDict, most specific first
+	fallbacks map[string]string    // locales to fall back on
+
+	missingMu sync.Mutex
+	missing   map[string]map[string]bool // untranslated messages per locale
 }
 
 // NewTranslator creates a translator.
 func NewTranslator() *Translator {
 	return &Translator{
-		locales: make(map[string]bool),
-		dict:    make(map[string]index),
-		regDict: make(map[string]index),
+		Dir: "translations",
+
+		locales:   make(map[string]bool),
+		dict:      make(map[string]index),
+		regDict:   make(map[string]index),
+		patterns:  make(map[string][]pattern),
+		fallbacks: make(map[string]string),
+		missing:   make(map[string]map[string]bool),
 	}
 }
 
-// Parse parses all the csv files in the translations folder and
+// Parse parses all the csv files in the translations folder, set in Dir, and
 // build dictionnary maps that will serve as databases for translations.
 // The name of csv file should be a string representing a locale (e.g. en_US).
 // When % is used in a csv translation, it will serve as a placeholder
 // and its value won’t be altered during the translation.
+//
+// Translations of a locale can also be split into several files in a folder
+// named after the locale (e.g. en_US/emails.csv). They are merged together with
+// the ones of the locale file, and a message defined twice is an error.
 func (tr *Translator) Parse(fsys fs.FS) error {
-	matches, err := fs.Glob(fsys, "translations/*.csv")
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	files, err := fs.Glob(fsys, path.Join(tr.Dir, "*.csv"))
+	if err != nil {
+		return err
+	}
+
+	nested, err := fs.Glob(fsys, path.Join(tr.Dir, "*", "*.csv"))
 	if err != nil {
 		return err
 	}
 
-	for _, path := range matches {
+	// group files by locale
+	byLocale := make(map[string][]string)
+	for _, path := range files {
 		base := filepath.Base(path)
 		locale := strings.TrimSuffix(base, filepath.Ext(base))
+		byLocale[locale] = append(byLocale[locale], path)
+	}
+	for _, path := range nested {
+		locale := filepath.Base(filepath.Dir(path))
+		byLocale[locale] = append(byLocale[locale], path)
+	}
 
-		re := regexp.MustCompile("^[a-z]{2}_[A-Z]{2}$")
-		if !re.MatchString(locale) {
+	for locale, paths := range byLocale {
+		if !localeRegexp.MatchString(locale) {
 			return fmt.Errorf("locale %s is not valid", locale)
 		}
 
+		idx, regIdx := make(index), make(index)
+		sources := make(map[string]string) // file defining each message
+
+		for _, path := range paths {
+			fileIdx, fileRegIdx, err := parseIndex(fsys, path)
+			if err != nil {
+				return err
+			}
+
+			for _, entries := range []struct{ from, to index }{{fileIdx, idx}, {fileRegIdx, regIdx}} {
+				for k, v := range entries.from {
+					if src, ok := sources[k]; ok {
+						return fmt.Errorf("translation %q of %s defined in both %s and %s", k, locale, src, path)
+					}
+					sources[k] = path
+					entries.to[k] = v
+				}
+			}
+		}
+
 		tr.locales[locale] = true
-		tr.dict[locale], tr.regDict[locale], err = parseIndex(fsys, path)
-		if err != nil {
+		tr.dict[locale], tr.regDict[locale] = idx, regIdx
+
+		if tr.patterns[locale], err = compilePatterns(tr.regDict[locale]); err != nil {
 			return err
 		}
 	}
@@ -72,6 +152,8 @@ func (tr *Translator) Parse(fsys fs.FS) error {
 }
 
 // parseIndex parses a csv file that contains key values entries into index maps.
+// Lines starting with # are comments, and values can be quoted following the csv rules
+// to contain commas or to span multiple lines.
 // It returns one regular index map for static translations, and a regex index map
 // which contains regex patterns and replacements for translations with placeholders.
 func parseIndex(fsys fs.FS, path string) (idx index, regIdx index, err error) {
@@ -79,82 +161,262 @@ func parseIndex(fsys fs.FS, path string) (idx index, regIdx index, err error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	defer f.Close()
 
 	idx = make(map[string]string)
 	regIdx = make(map[string]string)
 
 	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2 // a message and its translation
+	r.Comment = '#'
+
 	for {
 		line, err := r.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, nil, err
-		}
-		if len(line) != 2 {
-			return nil, nil, errors.New("error reading csv file")
+			// the csv error already contains the line number
+			return nil, nil, fmt.Errorf("cannot parse %s: %w", path, err)
 		}
 
-		pat := fmt.Sprintf("(^|[^%s])%s([^%s]|$)", placeholder, placeholder, placeholder)
-		re := regexp.MustCompile(pat)
+		idx.add(regIdx, line[0], line[1])
+	}
 
-		// no placeholder found
-		if !re.MatchString(line[0]) {
-			idx[line[0]] = line[1]
-			continue
+	return idx, regIdx, nil
+}
+
+// add adds a translation to the index, or to the regex index
+// if the message contains placeholders.
+func (idx index) add(regIdx index, msg, translation string) {
+	// no placeholder found
+	if !placeholderRegexp.MatchString(msg) {
+		idx[msg] = translation
+		return
+	}
+
+	key := placeholderRegexp.ReplaceAllString(regexp.QuoteMeta(msg), `${1}(.+)${2}`)
+
+	var i = 0
+	val := placeholderRegexp.ReplaceAllStringFunc(translation, func(s string) string {
+		i++
+		return strings.ReplaceAll(s, placeholder, fmt.Sprintf("${%d}", i))
+	})
+
+	regIdx[key] = val
+}
+
+// compilePatterns compiles the entries of a regex index into patterns.
+// They are sorted from the longest key to the shortest, so that the
+// most specific pattern is tried first.
+func compilePatterns(regIdx index) ([]pattern, error) {
+	keys := make([]string, 0, len(regIdx))
+	for k := range regIdx {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
 		}
+		return keys[i] < keys[j]
+	})
 
-		key := re.ReplaceAllString(line[0], `${1}(.+)${2}`)
+	patterns := make([]pattern, len(keys))
+	for i, k := range keys {
+		re, err := regexp.Compile(k)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = pattern{re: re, repl: regIdx[k]}
+	}
 
-		var i = 0
-		val := re.ReplaceAllStringFunc(line[1], func(s string) string {
-			i++
-			return strings.ReplaceAll(s, placeholder, fmt.Sprintf("${%d}", i))
-		})
+	return patterns, nil
+}
 
-		regIdx[key] = val
+// Reload parses the translation files again and replaces the dictionaries at once,
+// so that translations can be updated without restarting the application. Translations
+// being done during the reload keep using the previous dictionaries. If parsing fails,
+// the previous dictionaries are kept. Messages added with AddMessages are discarded,
+// while fallbacks are kept. The recorded missing messages are reset.
+func (tr *Translator) Reload(fsys fs.FS) error {
+	fresh := NewTranslator()
+	fresh.Dir = tr.Dir
+	if err := fresh.Parse(fsys); err != nil {
+		return err
 	}
 
-	return idx, regIdx, nil
+	tr.mu.Lock()
+	tr.locales = fresh.locales
+	tr.dict, tr.regDict = fresh.dict, fresh.regDict
+	tr.patterns = fresh.patterns
+	tr.mu.Unlock()
+
+	tr.missingMu.Lock()
+	tr.missing = make(map[string]map[string]bool)
+	tr.missingMu.Unlock()
+
+	return nil
 }
 
-// Translate translates a message into the language of the corresponding locale.
-// If the locale or the message is not found, it will be returned untranslated.
-func (tr *Translator) Translate(msg string, locale string) string {
-	if locale == defaultLocale {
-		return msg
+// AddMessages merges additional translations for a locale into the dictionnaries.
+// It allows to complete translations parsed from files with ones coming from another
+// source such as a database. Placeholders are handled the same way as in Parse.
+func (tr *Translator) AddMessages(locale string, messages map[string]string) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if !localeRegexp.MatchString(locale) {
+		return fmt.Errorf("locale %s is not valid", locale)
 	}
 
 	if _, ok := tr.dict[locale]; !ok {
-		return msg
+		tr.dict[locale] = make(index)
+		tr.regDict[locale] = make(index)
 	}
 
-	out, ok := tr.dict[locale][msg]
-	if ok {
-		return out
+	tr.locales[locale] = true
+
+	for msg, translation := range messages {
+		tr.dict[locale].add(tr.regDict[locale], msg, translation)
 	}
 
-	for k, v := range tr.regDict[locale] {
-		re := regexp.MustCompile(k)
-		if !re.MatchString(msg) {
-			continue
-		}
+	patterns, err := compilePatterns(tr.regDict[locale])
+	if err != nil {
+		return err
+	}
+	tr.patterns[locale] = patterns
+
+	return nil
+}
+
+// Export returns a copy of the static translations of a locale, indexed by message.
+// Translations with placeholders are not included as they are stored as patterns.
+func (tr *Translator) Export(locale string) (map[string]string, error) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	if !tr.locales[locale] {
+		return nil, fmt.Errorf("locale %s not found", locale)
+	}
 
-		out = re.ReplaceAllString(msg, v)
+	dict := make(map[string]string, len(tr.dict[locale]))
+	for msg, translation := range tr.dict[locale] {
+		dict[msg] = translation
 	}
 
-	if out != "" {
+	return dict, nil
+}
+
+// SetFallback defines a locale to fall back on when a message is not found
+// for the given locale. Fallbacks can be chained (e.g. fr_CA to fr_FR), and
+// the message will be returned untranslated at the end of the chain.
+func (tr *Translator) SetFallback(locale, fallback string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.fallbacks[locale] = fallback
+}
+
+// Translate translates a message into the language of the corresponding locale.
+// If the message is not found, the fallback chain of the locale is walked.
+// If the locale or the message is still not found, it will be returned untranslated.
+func (tr *Translator) Translate(msg string, locale string) string {
+	if out, ok := tr.translate(msg, locale); ok {
 		return out
 	}
 
+	// the lock is released, so that the callback can use the translator
+	if tr.Debug {
+		tr.recordMissing(msg, locale)
+	}
+
+	if tr.OnMissing != nil {
+		tr.OnMissing(locale, msg)
+	}
+
 	return msg
 }
 
+// translate walks the fallback chain of the locale to translate the message.
+// The ok flag is false if no translation is found.
+func (tr *Translator) translate(msg string, locale string) (string, bool) {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	visited := make(map[string]bool)
+
+	for locale != "" && !visited[locale] {
+		if locale == defaultLocale {
+			return msg, true
+		}
+
+		if out, ok := tr.lookup(msg, locale); ok {
+			return out, true
+		}
+
+		visited[locale] = true
+		locale = tr.fallbacks[locale]
+	}
+
+	return "", false
+}
+
+// recordMissing records a message that could not be translated for a locale.
+func (tr *Translator) recordMissing(msg string, locale string) {
+	tr.missingMu.Lock()
+	defer tr.missingMu.Unlock()
+
+	if tr.missing[locale] == nil {
+		tr.missing[locale] = make(map[string]bool)
+	}
+	tr.missing[locale][msg] = true
+}
+
+// Missing returns the sorted list of messages that could not be translated
+// for the given locale since the translator has been created. Messages are
+// only recorded in debug mode.
+func (tr *Translator) Missing(locale string) []string {
+	tr.missingMu.Lock()
+	defer tr.missingMu.Unlock()
+
+	var msgs []string
+	for msg := range tr.missing[locale] {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+
+	return msgs
+}
+
+// lookup searches the translation of a message in the dictionnaries of a locale.
+// For translations with placeholders, the first matching pattern wins.
+func (tr *Translator) lookup(msg string, locale string) (string, bool) {
+	if _, ok := tr.dict[locale]; !ok {
+		return "", false
+	}
+
+	out, ok := tr.dict[locale][msg]
+	if ok {
+		return out, true
+	}
+
+	for _, p := range tr.patterns[locale] {
+		if p.re.MatchString(msg) {
+			return p.re.ReplaceAllString(msg, p.repl), true
+		}
+	}
+
+	return "", false
+}
+
 // ReqLocale tries to return the locale from the request.
 // It tries to retrieve it first using the "lang" cookie and otherwise
 // using the "Accept-Language" request header. If the locale is not recognized
 // or not supported, it will return the default locale (en_US).
 func (tr *Translator) ReqLocale(r *http.Request) string {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
 	lang, err := r.Cookie("lang")
 	if err == nil {
 		if _, ok := tr.locales[lang.Value]; ok {
@@ -164,12 +426,18 @@ func (tr *Translator) ReqLocale(r *http.Request) string {
 		}
 	}
 
+	// languages are ordered by preference, and for each of them, the exact
+	// locale is preferred over another locale of the same language
 	langs, _, err := parseAcceptLanguage(r.Header.Get("Accept-Language"))
 	if err == nil {
 		for _, lang := range langs {
+			if lang == "*" {
+				return defaultLocale
+			}
+
 			if _, ok := tr.locales[lang]; ok {
 				return lang
-			} else if locale, err := tr.localeFromLang(lang); err == nil {
+			} else if locale, err := tr.localeFromLang(tr.langFromLocale(lang)); err == nil {
 				return locale
 			}
 		}
@@ -178,7 +446,9 @@ func (tr *Translator) ReqLocale(r *http.Request) string {
 	return defaultLocale
 }
 
-// parseAcceptLanguage parses a Accept-Language http header.
+// parseAcceptLanguage parses a Accept-Language http header. Language tags are
+// normalized to the form of locales, so that "en-gb" becomes "en_GB", and they are
+// sorted by quality weight. Tags with a weight of 0 are dropped.
 func parseAcceptLanguage(s string) (langs []string, q []float32, err error) {
 	var entry string
 	for s != "" {
@@ -187,7 +457,6 @@ func parseAcceptLanguage(s string) (langs []string, q []float32, err error) {
 		}
 
 		lang, weight := split(entry, ';')
-		langs = append(langs, lang)
 
 		// Scan the optional weight.
 		w := 1.0
@@ -205,6 +474,7 @@ func parseAcceptLanguage(s string) (langs []string, q []float32, err error) {
 			}
 		}
 
+		langs = append(langs, normalizeLangTag(lang))
 		q = append(q, float32(w))
 	}
 
@@ -212,6 +482,22 @@ func parseAcceptLanguage(s string) (langs []string, q []float32, err error) {
 	return langs, q, nil
 }
 
+// normalizeLangTag converts a language tag such as "en-GB" to the form of locales,
+// such as "en_GB". Other subtags than the language and the region, such as scripts,
+// are ignored, and the wildcard "*" is kept as is.
+func normalizeLangTag(tag string) string {
+	parts := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+
+	lang := strings.ToLower(parts[0])
+	for _, part := range parts[1:] {
+		if len(part) == 2 {
+			return lang + "_" + strings.ToUpper(part)
+		}
+	}
+
+	return lang
+}
+
 // consume removes a leading token c from s and returns the result or the empty
 // string if there is no such token.
 func consume(s string, c byte) string {
@@ -255,19 +541,74 @@ func (tr *Translator) langFromLocale(locale string) string {
 	return strings.Split(locale, "_")[0]
 }
 
-// localeFromLang returns the first locale matching the given lang.
+// rtlLangs are the languages written from right to left.
+var rtlLangs = map[string]bool{
+	"ar":  true, // arabic
+	"ckb": true, // central kurdish
+	"dv":  true, // divehi
+	"fa":  true, // persian
+	"he":  true, // hebrew
+	"ps":  true, // pashto
+	"sd":  true, // sindhi
+	"ug":  true, // uyghur
+	"ur":  true, // urdu
+	"yi":  true, // yiddish
+}
+
+// IsRTL returns true if the language of the locale is written from right to left.
+func (tr *Translator) IsRTL(locale string) bool {
+	return rtlLangs[tr.langFromLocale(locale)]
+}
+
+// dir returns the text direction of the locale, "rtl" or "ltr",
+// as expected by the dir html attribute.
+func (tr *Translator) dir(locale string) string {
+	if tr.IsRTL(locale) {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// localeFromLang returns the first locale in alphabetical order matching the given lang.
 func (tr *Translator) localeFromLang(lang string) (string, error) {
+	var matches []string
 	for locale := range tr.locales {
 		if strings.HasPrefix(locale, lang+"_") {
-			return locale, nil
+			matches = append(matches, locale)
 		}
 	}
 
+	if len(matches) > 0 {
+		sort.Strings(matches)
+		return matches[0], nil
+	}
+
 	return "", fmt.Errorf("no locale found for language %s", lang)
 }
 
+// layoutPresets maps preset names to the layouts of each locale.
+var layoutPresets = map[string]map[monday.Locale]string{
+	"date.full":   monday.FullFormatsByLocale,
+	"date.long":   monday.LongFormatsByLocale,
+	"date.medium": monday.MediumFormatsByLocale,
+	"date.short":  monday.ShortFormatsByLocale,
+	"datetime":    monday.DateTimeFormatsByLocale,
+}
+
 // Format uses the package monday to format a time.Time according to a locale
 // with month and days translated.
+//
+// Instead of a layout, a preset name can be given to use the layout appropriate
+// for the locale. Presets are "date.full", "date.long", "date.medium", "date.short"
+// and "datetime". Layouts of the default locale are used for unknown locales.
 func Format(dt time.Time, layout string, locale string) string {
+	if layouts, ok := layoutPresets[layout]; ok {
+		preset, ok := layouts[monday.Locale(locale)]
+		if !ok {
+			preset = layouts[monday.Locale(defaultLocale)]
+		}
+		layout = preset
+	}
+
 	return monday.Format(dt, layout, monday.Locale(locale))
 }
@@ -0,0 +1,230 @@
+package bow
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newBenchTranslator returns a translator with many placeholder translations.
+func newBenchTranslator(b *testing.B) *Translator {
+	var csv string
+	for i := 0; i < 100; i++ {
+		csv += fmt.Sprintf("\"Message %d for %%\",\"Message %d pour %%\"\n", i, i)
+	}
+
+	fs := fstest.MapFS{
+		"translations/fr_FR.csv": {Data: []byte(csv)},
+	}
+
+	tr := NewTranslator()
+	if err := tr.Parse(fs); err != nil {
+		b.Fatalf("cannot parse translations: %v", err)
+	}
+
+	return tr
+}
+
+func BenchmarkTranslate(b *testing.B) {
+	tr := newBenchTranslator(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Translate("Message 99 for John", "fr_FR")
+	}
+}
+
+// BenchmarkTranslateCompilePerCall measures the previous approach
+// that compiled placeholder regexes at each translation.
+func BenchmarkTranslateCompilePerCall(b *testing.B) {
+	tr := newBenchTranslator(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for k, v := range tr.regDict["fr_FR"] {
+			re := regexp.MustCompile(k)
+			if re.MatchString("Message 99 for John") {
+				re.ReplaceAllString("Message 99 for John", v)
+			}
+		}
+	}
+}
+
+func TestTranslateOverlappingPlaceholders(t *testing.T) {
+	fs := fstest.MapFS{
+		"translations/fr_FR.csv": {
+			Data: []byte("\"% items\",\"% articles\"\n\"You have % items\",\"Vous avez % articles\"\n"),
+		},
+	}
+
+	tr := NewTranslator()
+	if err := tr.Parse(fs); err != nil {
+		t.Fatalf("cannot parse translations: %v", err)
+	}
+
+	// run several times as map iteration order is random
+	for i := 0; i < 20; i++ {
+		if got, want := tr.Translate("You have 3 items", "fr_FR"), "Vous avez 3 articles"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+
+		if got, want := tr.Translate("3 items", "fr_FR"), "3 articles"; got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	fs := fstest.MapFS{
+		"translations/fr_FR.csv": {
+			Data: []byte("# comment\n\"Hello, world\",\"Bonjour, monde\"\nonly one field\n"),
+		},
+	}
+
+	err := NewTranslator().Parse(fs)
+	if err == nil {
+		t.Fatal("expected an error for a malformed line")
+	}
+
+	if want := "cannot parse translations/fr_FR.csv: record on line 3: wrong number of fields"; err.Error() != want {
+		t.Fatalf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	fs := fstest.MapFS{
+		"translations/fr_FR.csv": {
+			Data: []byte("Hello,Bonjour\n"),
+		},
+		"translations/fr_FR/emails.csv": {
+			Data: []byte("Welcome,Bienvenue\n"),
+		},
+	}
+
+	tr := NewTranslator()
+	if err := tr.Parse(fs); err != nil {
+		t.Fatalf("cannot parse translations: %v", err)
+	}
+
+	for msg, want := range map[string]string{"Hello": "Bonjour", "Welcome": "Bienvenue"} {
+		if got := tr.Translate(msg, "fr_FR"); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	fs["translations/fr_FR/errors.csv"] = &fstest.MapFile{Data: []byte("Hello,Salut\n")}
+
+	if err := NewTranslator().Parse(fs); err == nil {
+		t.Fatal("expected an error for a message defined twice")
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	langs, q, err := parseAcceptLanguage("fr-CA,fr;q=0.9,en;q=0.8,de;q=0,*;q=0.5")
+	if err != nil {
+		t.Fatalf("cannot parse header: %v", err)
+	}
+
+	want := []string{"fr_CA", "fr", "en", "*"}
+	if fmt.Sprint(langs) != fmt.Sprint(want) || len(q) != len(want) {
+		t.Fatalf("got %q with weights %v, want %q", langs, q, want)
+	}
+}
+
+func TestReqLocale(t *testing.T) {
+	tests := []struct {
+		locales []string
+		header  string
+		want    string
+	}{
+		{[]string{"fr_FR", "en_US"}, "fr-CA,fr;q=0.9,en;q=0.8", "fr_FR"},
+		{[]string{"fr_FR", "fr_CA", "en_US"}, "fr-CA,fr;q=0.9,en;q=0.8", "fr_CA"},
+		{[]string{"en_GB"}, "fr-CA,fr;q=0.9,en;q=0.8", "en_GB"},
+		{[]string{"fr_FR"}, "de,*;q=0.5,fr;q=0.1", defaultLocale},
+	}
+
+	for _, tt := range tests {
+		fs := fstest.MapFS{}
+		for _, locale := range tt.locales {
+			fs["translations/"+locale+".csv"] = &fstest.MapFile{Data: []byte("Hello,Hello\n")}
+		}
+
+		tr := NewTranslator()
+		if err := tr.Parse(fs); err != nil {
+			t.Fatalf("cannot parse translations: %v", err)
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", tt.header)
+
+		if got := tr.ReqLocale(r); got != tt.want {
+			t.Errorf("with %v and %q, got %q, want %q", tt.locales, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	fs := fstest.MapFS{
+		"translations/fr_FR.csv": {Data: []byte("Hello,Bonjour\n")},
+	}
+
+	tr := NewTranslator()
+	if err := tr.Parse(fs); err != nil {
+		t.Fatalf("cannot parse translations: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tr.Translate("Hello", "fr_FR")
+		}
+	}()
+
+	fs["translations/fr_FR.csv"] = &fstest.MapFile{Data: []byte("Hello,Salut\n")}
+	if err := tr.Reload(fs); err != nil {
+		t.Fatalf("cannot reload translations: %v", err)
+	}
+	<-done
+
+	if got := tr.Translate("Hello", "fr_FR"); got != "Salut" {
+		t.Fatalf("got %q, want %q", got, "Salut")
+	}
+
+	fs["translations/fr_FR.csv"] = &fstest.MapFile{Data: []byte("only one field\n")}
+	if err := tr.Reload(fs); err == nil {
+		t.Fatal("expected an error for malformed translations")
+	}
+
+	if got := tr.Translate("Hello", "fr_FR"); got != "Salut" {
+		t.Fatalf("expected previous translations to be kept, got %q", got)
+	}
+}
+
+func TestOnMissingUsesTranslator(t *testing.T) {
+	tr := NewTranslator()
+	tr.OnMissing = func(locale, msg string) {
+		if err := tr.AddMessages(locale, map[string]string{msg: "[" + msg + "]"}); err != nil {
+			t.Errorf("cannot add messages: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tr.Translate("Hello", "fr_FR")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("translate is blocked by the missing callback")
+	}
+
+	if got := tr.Translate("Hello", "fr_FR"); got != "[Hello]" {
+		t.Fatalf("got %q, want %q", got, "[Hello]")
+	}
+}
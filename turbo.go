@@ -0,0 +1,212 @@
+package bow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TurboFrame returns the id of the turbo frame that initiated the request,
+// as sent by Turbo in the "Turbo-Frame" header. It returns an empty
+// string if the request is not a frame request.
+func TurboFrame(r *http.Request) string {
+	return r.Header.Get("Turbo-Frame")
+}
+
+// IsTurboFrame returns true if the request has been initiated from a turbo frame.
+// It can be used in a handler to only render the content of the frame instead
+// of the full page with its layout.
+func IsTurboFrame(r *http.Request) bool {
+	return TurboFrame(r) != ""
+}
+
+// streamBuffer is the number of messages that can be queued for a connection.
+// When a client is too slow and its queue is full, messages are dropped.
+const streamBuffer = 16
+
+// StreamBroadcaster renders turbo streams and pushes them
+// to all the connected clients.
+type StreamBroadcaster struct {
+	views *Views
+
+	mu      sync.Mutex
+	conns   map[*StreamConn]bool
+	wsConns map[*WSConn]bool
+}
+
+// NewStreamBroadcaster creates a broadcaster rendering partials with the given views.
+func NewStreamBroadcaster(views *Views) *StreamBroadcaster {
+	return &StreamBroadcaster{
+		views:   views,
+		conns:   make(map[*StreamConn]bool),
+		wsConns: make(map[*WSConn]bool),
+	}
+}
+
+// StreamConn is a persistent connection to a client
+// receiving turbo streams as server-sent events.
+type StreamConn struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	msgs    chan []byte
+
+	broadcaster *StreamBroadcaster
+}
+
+// StreamSSE upgrades the response to a server-sent events stream and subscribes
+// it to the broadcasts of the core. The handler should then call Listen on the
+// returned connection to keep it open until the client disconnects.
+// In the page, the stream can be consumed with <turbo-stream-source src="...">.
+//
+// Take care that the WriteTimeout of the http server also applies to this connection.
+func (core *Core) StreamSSE(w http.ResponseWriter, r *http.Request) (*StreamConn, error) {
+	return core.streams.Subscribe(w, r)
+}
+
+// Broadcast renders the given partial as a turbo stream with the action and target,
+// and pushes it to all the connected clients. The partial is not rendered for a specific
+// client, so it must not use request-aware functions such as csrf or flash.
+func (core *Core) Broadcast(action, target, name string, data interface{}) error {
+	return core.streams.Broadcast(action, target, name, data)
+}
+
+// Subscribe upgrades the response to a server-sent events stream
+// and registers the connection to receive broadcasts. The connection is
+// unregistered once the request is done, even if Listen is never called.
+func (b *StreamBroadcaster) Subscribe(w http.ResponseWriter, r *http.Request) (*StreamConn, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported by the response writer")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	conn := &StreamConn{
+		w:           w,
+		flusher:     flusher,
+		ctx:         r.Context(),
+		msgs:        make(chan []byte, streamBuffer),
+		broadcaster: b,
+	}
+
+	b.mu.Lock()
+	b.conns[conn] = true
+	b.mu.Unlock()
+
+	// the context is canceled when the client disconnects or the handler returns
+	go func() {
+		<-conn.ctx.Done()
+		conn.unsubscribe()
+	}()
+
+	return conn, nil
+}
+
+// Broadcast renders the given partial as a turbo stream with the action and target,
+// and pushes it to all the connected clients. Websocket clients only receive it
+// if they are subscribed to the target.
+//
+// As partials are not rendered for a specific client, they are rendered with an empty
+// request that has no session. So broadcasted partials must not use request-aware
+// functions relying on the client, such as csrf or flash, which fail or return
+// unusable values. Client-specific content should rather be fetched by the page.
+func (b *StreamBroadcaster) Broadcast(action, target, name string, data interface{}) error {
+	partial, ok := b.views.partials[name]
+	if !ok {
+		return fmt.Errorf("partial %s not found", name)
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return err
+	}
+
+	buf, err := b.views.renderTemplate(r, name, partial, "main", data)
+	if err != nil {
+		return err
+	}
+
+	stream := turboStream(action, target, buf.String())
+	msg := sseMessage(stream)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for conn := range b.conns {
+		push(conn.msgs, msg)
+	}
+
+	for conn := range b.wsConns {
+		if conn.subscribed(target) {
+			push(conn.msgs, []byte(stream))
+		}
+	}
+
+	return nil
+}
+
+// push queues a message without blocking.
+// When the client is too slow and its queue is full, the message is dropped.
+func push(msgs chan []byte, msg []byte) {
+	select {
+	case msgs <- msg:
+	default:
+	}
+}
+
+// Listen writes broadcasted messages to the client and blocks
+// until the client disconnects. It then unsubscribes the connection.
+func (conn *StreamConn) Listen() {
+	defer conn.unsubscribe()
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			return
+		case msg := <-conn.msgs:
+			if _, err := conn.w.Write(msg); err != nil {
+				return
+			}
+			conn.flusher.Flush()
+		}
+	}
+}
+
+// unsubscribe stops sending broadcasts to the connection.
+func (conn *StreamConn) unsubscribe() {
+	conn.broadcaster.mu.Lock()
+	delete(conn.broadcaster.conns, conn)
+	conn.broadcaster.mu.Unlock()
+}
+
+// turboStream wraps content into a turbo stream element.
+func turboStream(action, target, content string) string {
+	action = template.HTMLEscapeString(action)
+	target = template.HTMLEscapeString(target)
+
+	if action == "remove" {
+		return fmt.Sprintf(`<turbo-stream action="%s" target="%s"></turbo-stream>`, action, target)
+	}
+
+	return fmt.Sprintf(`<turbo-stream action="%s" target="%s"><template>%s</template></turbo-stream>`, action, target, content)
+}
+
+// sseMessage formats data as a server-sent event message.
+// Each line of data has to be prefixed, and the message ends with a blank line.
+func sseMessage(data string) []byte {
+	var b strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
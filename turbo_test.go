@@ -0,0 +1,39 @@
+package bow
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSubscribeUnregisters(t *testing.T) {
+	b := NewStreamBroadcaster(NewViews())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	if _, err := b.Subscribe(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("cannot subscribe: %v", err)
+	}
+
+	// the handler returns without calling Listen
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		n := len(b.conns)
+		b.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected the connection to be unregistered when the request is done")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,52 @@
+package bow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// VersionHandler returns a handler responding with build information in json, along with
+// the go version and the uptime of the application. When a database is configured,
+// its health is also reported and a 503 Service Unavailable is sent if it cannot be reached.
+// The values are meant to be injected at build time using -ldflags.
+func (core *Core) VersionHandler(version, commit, buildTime string) http.Handler {
+	type info struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildTime string `json:"build_time"`
+		GoVersion string `json:"go_version"`
+		Uptime    string `json:"uptime"`
+		DB        string `json:"db,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+
+		resp := info{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+			GoVersion: runtime.Version(),
+			Uptime:    time.Since(core.startTime).Round(time.Second).String(),
+		}
+
+		if core.DB != nil && core.DB.db != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+			defer cancel()
+
+			resp.DB = "ok"
+			if err := core.DB.db.PingContext(ctx); err != nil {
+				resp.DB = "unavailable"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	})
+}
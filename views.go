@@ -3,6 +3,9 @@ package bow
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -12,13 +15,21 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"syscall"
+	texttemplate "text/template"
+	"time"
 )
 
 type contextKey int
 
 const (
 	contextKeyLayout contextKey = iota
+	contextKeyUserID
+	contextKeyMountPrefix
+	contextKeyData
+	contextKeyPartials
 
 	partialPrefix = "_"
 	layoutsFolder = "layouts"
@@ -30,32 +41,65 @@ type ReqFuncMap map[string]func(r *http.Request) interface{}
 // Views is an engine that will render Views from templates.
 type Views struct {
 	Logger *log.Logger
-	Debug  bool // to display errors in http responses
+	Debug  bool   // to display errors in http responses
+	Dir    string // folder of the filesystem containing the views
 
 	pages    map[string]*template.Template
 	partials map[string]*template.Template
+	texts    map[string]*texttemplate.Template
 
 	funcs    template.FuncMap
 	reqFuncs ReqFuncMap
+
+	leftDelim  string
+	rightDelim string
+
+	extensions []string // of html views
+
+	cache *renderCache
+
+	observer func(name string, bytes int, dur time.Duration)
 }
 
 // NewViews creates a views engine.
 func NewViews() *Views {
 	views := Views{
 		Logger: log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		Dir:    "views",
 
 		pages:    make(map[string]*template.Template),
 		partials: make(map[string]*template.Template),
+		texts:    make(map[string]*texttemplate.Template),
 		funcs:    make(template.FuncMap),
 		reqFuncs: make(ReqFuncMap),
+
+		extensions: []string{".html"},
+
+		cache: newRenderCache(maxCacheEntries),
 	}
 
 	views.Funcs(template.FuncMap{
-		"safe": safe,
+		"safe":     safe,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"title":    title,
+		"trim":     strings.TrimSpace,
+		"truncate": truncate,
+		"default":  fallback,
+		"add":      add,
+		"sub":      sub,
+		"mul":      mul,
+		"div":      div,
+		"mod":      mod,
 	})
 
 	views.ReqFuncs(ReqFuncMap{
 		"partial": views.partial,
+		"data": func(r *http.Request) interface{} {
+			return func(key string) interface{} {
+				return GetData(r, key)
+			}
+		},
 	})
 
 	return &views
@@ -67,6 +111,8 @@ func safe(s string) template.HTML {
 }
 
 // partial is meant to be added as a ReqFuncMap to include partials from within templates.
+// Partials can include other partials, and the chain of includes is tracked in the context
+// of the request so that an error is returned instead of overflowing the stack on cycles.
 func (views *Views) partial(r *http.Request) interface{} {
 	return func(name string, data interface{}) (template.HTML, error) {
 		partial, ok := views.partials[name]
@@ -74,8 +120,19 @@ func (views *Views) partial(r *http.Request) interface{} {
 			return "", fmt.Errorf("partial %s not found", name)
 		}
 
-		var buf bytes.Buffer
-		if err := views.renderTemplate(&buf, r, partial, "main", data); err != nil {
+		chain, _ := r.Context().Value(contextKeyPartials).([]string)
+		for _, included := range chain {
+			if included == name {
+				return "", fmt.Errorf("partial cycle detected: %s -> %s", strings.Join(chain, " -> "), name)
+			}
+		}
+
+		// copy to not share the backing array between sibling includes
+		chain = append(append([]string{}, chain...), name)
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyPartials, chain))
+
+		buf, err := views.renderTemplate(r, name, partial, "main", data)
+		if err != nil {
 			return "", err
 		}
 		return template.HTML(buf.String()), nil
@@ -102,12 +159,75 @@ func (views *Views) ReqFuncs(reqFuncs ReqFuncMap) {
 	}
 }
 
-// Parse walks a filesystem from the root folder to discover and parse
+// FuncNames returns the sorted names of all the functions registered
+// for templates, including request-aware ones. Builtin functions
+// of the template package are not part of the list.
+func (views *Views) FuncNames() []string {
+	names := make([]string, 0, len(views.funcs))
+	for k := range views.funcs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Templates returns the parsed templates of the pages, partials and text views by name,
+// so that tools such as linters can inspect them. Page templates also contain the layouts.
+// The templates are shared with the views engine, so they must not be modified.
+func (views *Views) Templates() (pages, partials map[string]*template.Template, texts map[string]*texttemplate.Template) {
+	pages = make(map[string]*template.Template, len(views.pages))
+	for k, tmpl := range views.pages {
+		pages[k] = tmpl
+	}
+
+	partials = make(map[string]*template.Template, len(views.partials))
+	for k, tmpl := range views.partials {
+		partials[k] = tmpl
+	}
+
+	texts = make(map[string]*texttemplate.Template, len(views.texts))
+	for k, tmpl := range views.texts {
+		texts[k] = tmpl
+	}
+
+	return pages, partials, texts
+}
+
+// Delims sets the action delimiters used when parsing views, layouts and partials.
+// An empty delimiter stands for the corresponding default, {{ or }}.
+func (views *Views) Delims(left, right string) {
+	views.leftDelim = left
+	views.rightDelim = right
+}
+
+// Extensions sets the file extensions of html views, layouts and partials
+// discovered by Parse, instead of the default .html.
+func (views *Views) Extensions(exts ...string) {
+	views.extensions = exts
+}
+
+// extension returns the html view extension matching the path, or an empty string.
+// The longest one is chosen so that compound extensions such as .tmpl.html are supported.
+func (views *Views) extension(path string) string {
+	var match string
+	for _, ext := range views.extensions {
+		if strings.HasSuffix(path, ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	return match
+}
+
+// Parse walks a filesystem from the views folder, set in Dir, to discover and parse
 // html files into views. Files starting with an underscore are partial views.
+// Other extensions than .html can be configured using Extensions.
 // Files in the layouts folder not starting with underscore are layouts. The rest of
 // html files are full page views. The funcs parameter is a list of functions that is
 // attached to views.
 //
+// Txt files are parsed as plain-text views using text/template, so that their content
+// is not HTML escaped. They live in their own namespace and are rendered with RenderText.
+//
 // Views, layouts and partials will be referred to with their path, but without the
 // root folder, and without the file extension.
 //
@@ -115,15 +235,37 @@ func (views *Views) ReqFuncs(reqFuncs ReqFuncMap) {
 //
 // Partials files are named with a leading underscore to distinguish them from regular views,
 // but will be referred to without the underscore.
+//
+// If there is no views folder, there will simply be no views to render.
 func (views *Views) Parse(fsys fs.FS) error {
-	var pages, partials, layouts []string
+	var pages, partials, layouts, texts []string
+
+	// allow apps without views such as api-only ones
+	if _, err := fs.Stat(fsys, views.Dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	// template names are relative to the views folder
+	fsys, err := fs.Sub(fsys, views.Dir)
+	if err != nil {
+		return err
+	}
 
-	err := fs.WalkDir(fsys, "views", func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if d.IsDir() || filepath.Ext(path) != ".html" {
+		if d.IsDir() {
+			return nil
+		}
+
+		if filepath.Ext(path) == ".txt" {
+			texts = append(texts, path)
+			return nil
+		}
+
+		if views.extension(path) == "" {
 			return nil
 		}
 
@@ -132,7 +274,7 @@ func (views *Views) Parse(fsys fs.FS) error {
 		switch {
 		case filepath.Base(path)[0:1] == partialPrefix:
 			partials = append(partials, path)
-		case len(dirs) > 1 && dirs[1] == layoutsFolder:
+		case dirs[0] == layoutsFolder:
 			layouts = append(layouts, path)
 		default:
 			pages = append(pages, path)
@@ -145,30 +287,68 @@ func (views *Views) Parse(fsys fs.FS) error {
 	}
 
 	for _, page := range pages {
-		tmpl, err := parseTemplate(fsys, views.funcs, page, layouts)
+		tmpl, err := views.parseTemplate(fsys, page, layouts)
 		if err != nil {
-			return err
+			return views.parseError(page, err)
 		}
 
-		views.pages[templateName(page)] = tmpl
+		views.pages[templateName(page, views.extension(page))] = tmpl
 	}
 
 	for _, partial := range partials {
-		tmpl, err := parseTemplate(fsys, views.funcs, partial, nil)
+		tmpl, err := views.parseTemplate(fsys, partial, nil)
 		if err != nil {
-			return err
+			return views.parseError(partial, err)
 		}
 
-		views.partials[templateName(partial)] = tmpl
+		views.partials[templateName(partial, views.extension(partial))] = tmpl
+	}
+
+	for _, text := range texts {
+		tmpl, err := views.parseTextTemplate(fsys, text)
+		if err != nil {
+			return views.parseError(text, err)
+		}
+
+		views.texts[templateName(text, ".txt")] = tmpl
+	}
+
+	return nil
+}
+
+// parseError wraps an error happening while parsing the file at path. To help finding
+// mismatches between templates and registered funcs, the list of funcs is added
+// when a template uses a function that is not defined.
+func (views *Views) parseError(path string, err error) error {
+	if msg := err.Error(); strings.Contains(msg, "function \"") && strings.Contains(msg, "not defined") {
+		return fmt.Errorf("cannot parse %s: %w (registered funcs: %s)", filepath.Join(views.Dir, path), err, strings.Join(views.FuncNames(), ", "))
+	}
+
+	return fmt.Errorf("cannot parse %s: %w", filepath.Join(views.Dir, path), err)
+}
+
+// AddLayout registers a layout from a string, in addition to the ones parsed from the
+// layouts folder, so that it can be applied with WithLayout or ApplyLayout. As layouts are
+// associated to each page when parsing, the layout is added to all the pages already parsed,
+// and replaces an existing layout with the same name. Pages parsed afterwards won't have it.
+// It is not safe to call it while views are being rendered, so it should be called
+// before starting the server.
+func (views *Views) AddLayout(name, content string) error {
+	name = filepath.Join(layoutsFolder, name)
+
+	for page, tmpl := range views.pages {
+		if _, err := tmpl.New(name).Parse(content); err != nil {
+			return fmt.Errorf("cannot add layout %s to %s: %w", name, page, err)
+		}
 	}
 
 	return nil
 }
 
 // parseTemplate creates a new template from the given path and parses the main and
-// associated templates from the given filesystem. It also attached funcs.
-func parseTemplate(fsys fs.FS, funcs template.FuncMap, main string, associated []string) (*template.Template, error) {
-	tmpl := template.New("main").Funcs(funcs)
+// associated templates from the given filesystem. It also attached funcs and delimiters.
+func (views *Views) parseTemplate(fsys fs.FS, main string, associated []string) (*template.Template, error) {
+	tmpl := template.New("main").Delims(views.leftDelim, views.rightDelim).Funcs(views.funcs)
 
 	if main != "" {
 		b, err := fs.ReadFile(fsys, main)
@@ -188,7 +368,7 @@ func parseTemplate(fsys fs.FS, funcs template.FuncMap, main string, associated [
 			return nil, err
 		}
 
-		_, err = tmpl.New(templateName(path)).Parse(string(b))
+		_, err = tmpl.New(templateName(path, views.extension(path))).Parse(string(b))
 		if err != nil {
 			return nil, err
 		}
@@ -197,21 +377,31 @@ func parseTemplate(fsys fs.FS, funcs template.FuncMap, main string, associated [
 	return tmpl, nil
 }
 
-// templateName returns a template name from a path.
-// It removes the extension, removes the leading "_" from partials
-// and trims the root directory.
-func templateName(path string) string {
+// parseTextTemplate creates a new plain-text template from the given path.
+// It also attached funcs and delimiters.
+func (views *Views) parseTextTemplate(fsys fs.FS, path string) (*texttemplate.Template, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return texttemplate.New("main").
+		Delims(views.leftDelim, views.rightDelim).
+		Funcs(texttemplate.FuncMap(views.funcs)).
+		Parse(string(b))
+}
+
+// templateName returns a template name from a path relative to the views folder.
+// It removes the given extension and removes the leading "_" from partials.
+func templateName(path, ext string) string {
 	base := filepath.Base(path)
-	base = strings.TrimSuffix(base, filepath.Ext(base))
+	base = strings.TrimSuffix(base, ext)
 
 	if base[0:1] == partialPrefix {
 		base = base[1:]
 	}
 
-	dirs := strings.Split(filepath.Dir(path), string(os.PathSeparator))
-	dir := filepath.Join(dirs[1:]...)
-
-	return filepath.Join(dir, base)
+	return filepath.Join(filepath.Dir(path), base)
 }
 
 // Render renders a given view or partial.
@@ -221,18 +411,178 @@ func templateName(path string) string {
 func (views *Views) Render(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
 	w.Header().Set("Content-Type", "text/html")
 
+	tmpl, entry, err := views.lookup(r, name)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	// render before writing the status code, so that errors result in a 500
+	buf, err := views.renderTemplate(r, name, tmpl, entry, data)
+	if err != nil {
+		views.renderFailed(w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	if _, err := buf.WriteTo(w); err != nil {
+		views.renderFailed(w, r, err)
+	}
+}
+
+// MustRender renders a view as Render does, but panics if the view or its layout does
+// not exist, as it is a programming error such as a typo in the name of the view rather
+// than a runtime one. The panic is recovered by the StdChain, which sends a 500.
+// Errors happening while executing the template are handled as with Render.
+func (views *Views) MustRender(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	if _, _, err := views.lookup(r, name); err != nil {
+		panic(err)
+	}
+
+	views.Render(w, r, status, name, data)
+}
+
+// RenderWithETag renders a view as Render does, but also sends an ETag computed from the
+// rendered content. On GET and HEAD requests with a successful status, if the If-None-Match
+// header of the request matches the ETag, a 304 Not Modified is sent without body.
+// This is useful to save bandwidth for pages that the client already has.
+// As dynamic routes are not cached by default, such routes should use the AllowCache middleware.
+func (views *Views) RenderWithETag(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+
+	tmpl, entry, err := views.lookup(r, name)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	buf, err := views.renderTemplate(r, name, tmpl, entry, data)
+	if err != nil {
+		views.renderFailed(w, r, err)
+		return
+	}
+
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		sum := sha256.Sum256(buf.Bytes())
+		etag := fmt.Sprintf(`"%x"`, sum[:16])
+		w.Header().Set("ETag", etag)
+
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.WriteHeader(status)
+
+	if _, err := buf.WriteTo(w); err != nil {
+		views.renderFailed(w, r, err)
+	}
+}
+
+// etagMatch reports whether the If-None-Match header matches the etag.
+// Weak comparison is used, as recommended for If-None-Match.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPartialIn renders the partial name nested inside the partial wrapper, so that
+// partials can share a common shell such as a card. The wrapper includes the content
+// of the partial where it calls {{ template "content" . }}, and both receive data.
+// Templates defined in the partial are available to the wrapper as well.
+func (views *Views) RenderPartialIn(w http.ResponseWriter, r *http.Request, wrapper, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+
+	tmpl, err := views.wrapPartial(wrapper, name)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	buf, err := views.renderTemplate(r, name, tmpl, "main", data)
+	if err != nil {
+		views.renderFailed(w, r, err)
+		return
+	}
+
+	if _, err := buf.WriteTo(w); err != nil {
+		views.renderFailed(w, r, err)
+	}
+}
+
+// wrapPartial returns a copy of the wrapper partial in which the "content" template
+// is the partial name.
+func (views *Views) wrapPartial(wrapper, name string) (*template.Template, error) {
+	wrap, ok := views.partials[wrapper]
+	if !ok {
+		return nil, fmt.Errorf("partial %s not found", wrapper)
+	}
+
 	partial, ok := views.partials[name]
-	if ok {
-		if err := views.renderTemplate(w, r, partial, "main", data); err != nil {
-			views.ServerError(w, err)
+	if !ok {
+		return nil, fmt.Errorf("partial %s not found", name)
+	}
+
+	tmpl, err := wrap.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range partial.Templates() {
+		if t.Tree == nil || t.Name() == "main" {
+			continue
+		}
+
+		if _, err := tmpl.AddParseTree(t.Name(), t.Tree); err != nil {
+			return nil, err
 		}
+	}
+
+	if _, err := tmpl.AddParseTree("content", partial.Tree); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// renderFailed handles an error happening while rendering. If the client has gone away,
+// the failure is only logged as no response can be sent anymore.
+func (views *Views) renderFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		views.Logger.Printf("render aborted, client has gone away: %v", err)
 		return
 	}
 
+	views.ServerError(w, err)
+}
+
+// clientGone returns true if the error is caused by a client that has disconnected.
+func clientGone(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// lookup returns the template corresponding to the given view or partial name,
+// along with the name of the template to execute. For page views, it is the name
+// of the layout defined for the request.
+func (views *Views) lookup(r *http.Request, name string) (*template.Template, string, error) {
+	partial, ok := views.partials[name]
+	if ok {
+		return partial, "main", nil
+	}
+
 	view, ok := views.pages[name]
 	if !ok {
-		views.ServerError(w, fmt.Errorf("view %s not found", name))
-		return
+		return nil, "", fmt.Errorf("view %s not found", name)
 	}
 
 	layout, ok := r.Context().Value(contextKeyLayout).(string)
@@ -243,33 +593,169 @@ func (views *Views) Render(w http.ResponseWriter, r *http.Request, status int, n
 	}
 
 	if view.Lookup(layout) == nil {
-		views.ServerError(w, fmt.Errorf("layout %s not found", layout))
+		return nil, "", fmt.Errorf("layout %s not found", layout)
+	}
+
+	return view, layout, nil
+}
+
+// RenderCached is similar to Render, but keeps the rendered output in memory
+// and serves it from there until ttl expires. The cache key is computed from
+// the view name and a hash of the json representation of data. If data cannot be
+// marshalled, the view is rendered without being cached.
+//
+// Take care that request-aware functions (such as csrf or flash) are evaluated
+// only once when the output is cached, and that their result will be served to
+// all subsequent requests. Only use it for views that don't depend on the request.
+//
+// Responses served from the cache are not reported to the render observer, as nothing
+// is rendered, and no ETag is sent. Use RenderWithETag for conditional requests.
+func (views *Views) RenderCached(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}, ttl time.Duration) {
+	w.Header().Set("Content-Type", "text/html")
+
+	tmpl, entry, err := views.lookup(r, name)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	key, err := cacheKey(name, entry, data)
+	if err != nil {
+		views.Render(w, r, status, name, data)
+		return
+	}
+
+	if body, ok := views.cache.get(key); ok {
+		w.WriteHeader(status)
+
+		if _, err := w.Write(body); err != nil {
+			views.renderFailed(w, r, err)
+		}
 		return
 	}
 
-	// write http status code
+	buf, err := views.renderTemplate(r, name, tmpl, entry, data)
+	if err != nil {
+		views.renderFailed(w, r, err)
+		return
+	}
+
+	views.cache.put(key, buf.Bytes(), ttl)
+
 	w.WriteHeader(status)
 
-	if err := views.renderTemplate(w, r, view, layout, data); err != nil {
-		views.ServerError(w, err)
+	if _, err := buf.WriteTo(w); err != nil {
+		views.renderFailed(w, r, err)
+	}
+}
+
+// renderTemplate injects dynamic funcs and renders the given template into a buffer, so that runtime
+// errors are caught before anything is written. The view name is only used to report the render to the observer.
+func (views *Views) renderTemplate(r *http.Request, view string, tmpl *template.Template, name string, data interface{}) (*bytes.Buffer, error) {
+	start := time.Now()
+
+	tmpl, err := views.withReqFuncs(r, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+
+	if views.observer != nil {
+		views.observer(view, buf.Len(), time.Since(start))
 	}
+
+	return &buf, nil
 }
 
-// renderTemplate injects dynamic funcs and renders the given template using a buffer to catch runtime errors.
-func (views *Views) renderTemplate(w io.Writer, r *http.Request, tmpl *template.Template, name string, data interface{}) error {
+// withReqFuncs returns a copy of the template in which request-aware funcs are injected.
+func (views *Views) withReqFuncs(r *http.Request, tmpl *template.Template) (*template.Template, error) {
 	tmpl, err := tmpl.Clone()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	return tmpl.Funcs(views.reqFuncMap(r)), nil
+}
+
+// reqFuncMap returns the request-aware funcs bound to the request. A new map is built
+// for each render, as the shared funcs must not be modified by concurrent renders.
+func (views *Views) reqFuncMap(r *http.Request) template.FuncMap {
+	funcs := make(template.FuncMap, len(views.reqFuncs))
 	for k, fn := range views.reqFuncs {
-		views.funcs[k] = fn(r)
+		funcs[k] = fn(r)
+	}
+	return funcs
+}
+
+// RenderStreaming is similar to Render, but executes the view directly into the response
+// instead of using a buffer. It lowers the memory usage and the time to first byte of
+// large pages. The trade-off is that an error happening during the rendering cannot be
+// reported to the client, as the status code and part of the page have already been sent.
+// Such an error is only logged and the page is left truncated. Prefer Render otherwise.
+func (views *Views) RenderStreaming(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+
+	start := time.Now()
+
+	tmpl, entry, err := views.lookup(r, name)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	tmpl, err = views.withReqFuncs(r, tmpl)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	cw := &countingWriter{w: w}
+	if err := tmpl.ExecuteTemplate(cw, entry, data); err != nil {
+		views.Logger.Printf("streaming render of %s failed: %v", name, err)
+		return
+	}
+
+	if views.observer != nil {
+		views.observer(name, cw.n, time.Since(start))
 	}
+}
 
-	tmpl.Funcs(views.funcs)
+// countingWriter counts the number of bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += n
+	return n, err
+}
+
+// RenderText renders a given plain-text view into w.
+// Contrary to Render, it does not deal with http responses, so that it can
+// be used to generate content such as plain-text emails. Errors are returned to the caller.
+func (views *Views) RenderText(w io.Writer, r *http.Request, name string, data interface{}) error {
+	text, ok := views.texts[name]
+	if !ok {
+		return fmt.Errorf("text view %s not found", name)
+	}
+
+	tmpl, err := text.Clone()
+	if err != nil {
+		return err
+	}
+
+	tmpl.Funcs(texttemplate.FuncMap(views.reqFuncMap(r)))
 
 	var buf bytes.Buffer
-	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+	if err := tmpl.ExecuteTemplate(&buf, "main", data); err != nil {
 		return err
 	}
 
@@ -282,7 +768,14 @@ func (views *Views) renderTemplate(w io.Writer, r *http.Request, tmpl *template.
 
 // ServerError writes an error message and stack trace to the logger,
 // then sends a generic 500 Internal Server Error response to the user.
+// If the error is caused by a client that has disconnected, such as a broken pipe,
+// it is only logged without stack trace and no response is sent.
 func (views *Views) ServerError(w http.ResponseWriter, err error) {
+	if clientGone(err) {
+		views.Logger.Printf("client has gone away: %v", err)
+		return
+	}
+
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
 	views.Logger.Output(2, trace)
 
@@ -300,6 +793,89 @@ func (views *Views) ClientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// JSON sends v encoded as json with the given status code, for api endpoints.
+// The value is encoded before anything is written, so that an encoding
+// error results in a 500 Internal Server Error.
+func (views *Views) JSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		views.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+// JSONError sends an error as json with the given status code, for api endpoints,
+// in the form {"error": {"status": 404, "message": "Not Found"}}. If msg is empty,
+// the description of the status is used as with ClientError.
+func (views *Views) JSONError(w http.ResponseWriter, status int, msg string) {
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+
+	type jsonError struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}
+
+	views.JSON(w, status, map[string]jsonError{
+		"error": {Status: status, Message: msg},
+	})
+}
+
+// RenderError renders an error page with the given status code. The view errors/<status>
+// is used if it exists, such as views/errors/404.html, then the generic view errors/error.
+// Without those views, a plain text description of the status is sent as with ClientError.
+//
+// In debug mode, if the status is 500 and data is an error, the error and stack trace
+// are sent as with ServerError.
+func (views *Views) RenderError(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	if err, ok := data.(error); ok && views.Debug && status == http.StatusInternalServerError {
+		views.ServerError(w, err)
+		return
+	}
+
+	if name, ok := views.errorView(status); ok {
+		views.Render(w, r, status, name, data)
+		return
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+// errorView returns the name of the view to render for an error status.
+func (views *Views) errorView(status int) (string, bool) {
+	for _, name := range []string{fmt.Sprintf("errors/%d", status), "errors/error"} {
+		if _, ok := views.pages[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// hasErrorView returns true if an error view can be rendered for the status.
+func (views *Views) hasErrorView(status int) bool {
+	_, ok := views.errorView(status)
+	return ok
+}
+
+// Redirect redirects the request to the given url.
+// For non-GET requests such as form submissions, it uses 303 See Other so that
+// the client follows with a GET request, which is what Turbo expects. Otherwise,
+// it uses 302 Found. As flash messages are stored in the session, they will
+// be displayed on the page the client is redirected to.
+func (views *Views) Redirect(w http.ResponseWriter, r *http.Request, url string) {
+	status := http.StatusFound
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusSeeOther
+	}
+
+	http.Redirect(w, r, url, status)
+}
+
 // WithLayout returns a shallow copy of the request but with the information of the layout to apply.
 // It can be used in a handler before calling render to change the layout.
 func WithLayout(r *http.Request, layout string) *http.Request {
@@ -319,3 +895,27 @@ func ApplyLayout(layout string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// SetData returns a shallow copy of the request holding the value under the given key,
+// so that it can be computed once and retrieved by handlers with GetData, or in views and
+// partials using the "data" template func, such as {{ (data "user").Name }}.
+func SetData(r *http.Request, key string, val interface{}) *http.Request {
+	prev, _ := r.Context().Value(contextKeyData).(map[string]interface{})
+
+	// copy to not alter the data of the parent request
+	data := make(map[string]interface{}, len(prev)+1)
+	for k, v := range prev {
+		data[k] = v
+	}
+	data[key] = val
+
+	ctx := context.WithValue(r.Context(), contextKeyData, data)
+	return r.WithContext(ctx)
+}
+
+// GetData returns the value stored in the request under the given key using SetData,
+// or nil if there is none.
+func GetData(r *http.Request, key string) interface{} {
+	data, _ := r.Context().Value(contextKeyData).(map[string]interface{})
+	return data[key]
+}
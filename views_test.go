@@ -0,0 +1,246 @@
+package bow
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// brokenWriter simulates a client that has disconnected.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (w *brokenWriter) WriteHeader(status int) {
+	w.statuses = append(w.statuses, status)
+}
+
+func (w *brokenWriter) Write(b []byte) (int, error) {
+	return 0, syscall.EPIPE
+}
+
+func TestRenderCancelled(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"views/index.html": {
+			Data: []byte(`{{ define "main" }}hello, world{{ end }}`),
+		},
+	}
+
+	var logs bytes.Buffer
+	core, err := NewCore(fs, WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := &brokenWriter{ResponseRecorder: httptest.NewRecorder()}
+
+	core.Views.Render(w, r, http.StatusOK, "index", nil)
+
+	if len(w.statuses) != 1 || w.statuses[0] != http.StatusOK {
+		t.Fatalf("expected only the initial status to be written, got %v", w.statuses)
+	}
+
+	if strings.Contains(logs.String(), "goroutine") {
+		t.Fatalf("expected no stack trace to be logged, got %q", logs.String())
+	}
+}
+
+func TestPartialCycle(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"views/index.html": {
+			Data: []byte(`{{ define "main" }}{{ partial "ping" . }}{{ end }}`),
+		},
+		"views/_ping.html": {
+			Data: []byte(`ping {{ partial "pong" . }}`),
+		},
+		"views/_pong.html": {
+			Data: []byte(`pong {{ partial "ping" . }}`),
+		},
+	}
+
+	var logs bytes.Buffer
+	core, err := NewCore(fs, WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	core.Views.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "index", nil)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if want := "partial cycle detected: ping -> pong -> ping"; !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected %q in logs, got %q", want, logs.String())
+	}
+}
+
+func TestRenderWithETag(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"views/index.html": {
+			Data: []byte(`{{ define "main" }}hello, world{{ end }}`),
+		},
+	}
+
+	core, err := NewCore(fs)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	core.Views.RenderWithETag(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "index", nil)
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a 200 with an etag, got %d and %q", w.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	core.Views.RenderWithETag(w, r, http.StatusOK, "index", nil)
+
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected an empty 304, got %d with %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	core.Views.RenderWithETag(w, r, http.StatusOK, "index", nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a 200 for unsafe methods, got %d", w.Code)
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewViews().JSONError(w, http.StatusNotFound, "")
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("got content type %q, want json", ct)
+	}
+
+	if want := `{"error":{"status":404,"message":"Not Found"}}` + "\n"; w.Code != http.StatusNotFound || w.Body.String() != want {
+		t.Fatalf("got %d with %q, want %d with %q", w.Code, w.Body.String(), http.StatusNotFound, want)
+	}
+}
+
+func TestMustRenderMissingView(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for a missing view")
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	NewViews().MustRender(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "unknown", nil)
+}
+
+func TestRenderConcurrent(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`{{ template "main" . }}`),
+		},
+		"views/index.html": {
+			Data: []byte(`{{ define "main" }}{{ data "user" }}{{ end }}`),
+		},
+	}
+
+	core, err := NewCore(fs)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				r := SetData(httptest.NewRequest(http.MethodGet, "/", nil), "user", user)
+				w := httptest.NewRecorder()
+				core.Views.Render(w, r, http.StatusOK, "index", nil)
+
+				if got := w.Body.String(); got != user {
+					t.Errorf("got %q, want the data of its own request %q", got, user)
+					return
+				}
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+func TestRenderCachedLayouts(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/layouts/base.html": {
+			Data: []byte(`base {{ template "main" . }}`),
+		},
+		"views/layouts/admin.html": {
+			Data: []byte(`admin {{ template "main" . }}`),
+		},
+		"views/index.html": {
+			Data: []byte(`{{ define "main" }}hello{{ end }}`),
+		},
+	}
+
+	core, err := NewCore(fs)
+	if err != nil {
+		t.Fatalf("cannot create core: %v", err)
+	}
+
+	for _, layout := range []string{"base", "admin"} {
+		r := WithLayout(httptest.NewRequest(http.MethodGet, "/", nil), layout)
+		w := httptest.NewRecorder()
+		core.Views.RenderCached(w, r, http.StatusOK, "index", nil, time.Minute)
+
+		if want := layout + " hello"; w.Body.String() != want {
+			t.Fatalf("got %q, want %q", w.Body.String(), want)
+		}
+	}
+}
+
+func TestParseUndefinedFunc(t *testing.T) {
+	fs := fstest.MapFS{
+		"views/_card.html": {
+			Data: []byte(`{{ uppercase .Name }}`),
+		},
+	}
+
+	err := NewViews().Parse(fs)
+	if err == nil {
+		t.Fatal("expected an error for an undefined func")
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "views/_card.html") || !strings.Contains(msg, "registered funcs: ") || !strings.Contains(msg, "upper") {
+		t.Fatalf("expected the path and the registered funcs in the error, got %q", msg)
+	}
+}
@@ -0,0 +1,152 @@
+package bow
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WSConn is a websocket connection to a client receiving turbo streams
+// for the targets it is subscribed to.
+//
+// In the page, the stream can be consumed by connecting a WebSocket
+// with Turbo.connectStreamSource.
+type WSConn struct {
+	conn *websocket.Conn
+	msgs chan []byte
+
+	mu      sync.RWMutex
+	targets map[string]bool
+
+	broadcaster *StreamBroadcaster
+}
+
+// StreamWS upgrades the request to a websocket connection and registers it
+// to the broadcasts of the core. The handler should subscribe the connection to
+// targets and then call Listen to keep it open until the client disconnects.
+// The upgrade only accepts requests coming from the same origin.
+func (core *Core) StreamWS(w http.ResponseWriter, r *http.Request) (*WSConn, error) {
+	return core.streams.SubscribeWS(w, r)
+}
+
+// SubscribeWS upgrades the request to a websocket connection
+// and registers it to receive broadcasts. The connection is unregistered
+// and closed once the handler returns, even if Listen is never called.
+func (b *StreamBroadcaster) SubscribeWS(w http.ResponseWriter, r *http.Request) (*WSConn, error) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	wsConn := &WSConn{
+		conn:        conn,
+		msgs:        make(chan []byte, streamBuffer),
+		targets:     make(map[string]bool),
+		broadcaster: b,
+	}
+
+	b.mu.Lock()
+	b.wsConns[wsConn] = true
+	b.mu.Unlock()
+
+	// the context of a hijacked request is canceled when the handler returns
+	go func() {
+		<-r.Context().Done()
+		wsConn.close()
+	}()
+
+	return wsConn, nil
+}
+
+// Subscribe subscribes the connection to broadcasts for the given targets.
+func (conn *WSConn) Subscribe(targets ...string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	for _, target := range targets {
+		conn.targets[target] = true
+	}
+}
+
+// Unsubscribe stops sending broadcasts for the given targets to the connection.
+func (conn *WSConn) Unsubscribe(targets ...string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	for _, target := range targets {
+		delete(conn.targets, target)
+	}
+}
+
+func (conn *WSConn) subscribed(target string) bool {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return conn.targets[target]
+}
+
+// close unsubscribes the connection and closes it.
+func (conn *WSConn) close() {
+	conn.broadcaster.mu.Lock()
+	delete(conn.broadcaster.wsConns, conn)
+	conn.broadcaster.mu.Unlock()
+
+	conn.conn.Close()
+}
+
+// Listen writes broadcasted messages to the client and blocks until
+// the client disconnects. It then unsubscribes and closes the connection.
+// All the writes happen from Listen, so it should only be called once.
+func (conn *WSConn) Listen() {
+	defer conn.close()
+
+	// reading is needed to process control messages
+	// and to detect that the client went away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.conn.SetPongHandler(func(string) error {
+			return conn.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			if _, _, err := conn.conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case msg := <-conn.msgs:
+			conn.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}